@@ -0,0 +1,57 @@
+package ftps_qftp_client
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SymlinkPolicy decides how UploadDir handles symbolic links in the local tree.
+type SymlinkPolicy int
+
+// The different policies for symbolic links
+const (
+	SkipSymlinks   SymlinkPolicy = iota // links are not uploaded
+	FollowSymlinks                      // the targets of the links are uploaded, links to directories are followed unless they form a loop
+)
+
+// DirTransferOptions configures the transfer of a directory tree with
+// DownloadDir and UploadDir.
+type DirTransferOptions struct {
+	Parallel int           // number of parallel connections, at least one is used
+	Resume   bool          // continue interrupted transfers of files, see ResumeRetr and ResumeStor
+	Symlinks SymlinkPolicy // handling of local symbolic links by UploadDir
+}
+
+// ValidEntryName reports whether the name of an entry in a listing of the
+// server can be used as the name of a local file. The entries of the current
+// and parent directory and names with a path separator, which could leave
+// the local directory, are not valid.
+func ValidEntryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
+
+// RemoveAllError is returned by RemoveAll with the paths, which could not be
+// removed, and the errors of their removal.
+type RemoveAllError struct {
+	Paths  []string
+	Errors []error
+}
+
+func (e *RemoveAllError) Error() string {
+	message := "Could not remove " + strconv.Itoa(len(e.Paths)) + " paths."
+	for i, path := range e.Paths {
+		message = message + "\n" + path + ": " + e.Errors[i].Error()
+	}
+	return message
+}
+
+// Unwrap returns the errors of the removal.
+func (e *RemoveAllError) Unwrap() []error {
+	return e.Errors
+}
+
+// Add adds a path, which could not be removed.
+func (e *RemoveAllError) Add(path string, err error) {
+	e.Paths = append(e.Paths, path)
+	e.Errors = append(e.Errors, err)
+}
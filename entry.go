@@ -2,6 +2,7 @@ package ftps_qftp_client
 
 import (
 	"errors"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +24,23 @@ type Entry struct {
 	Type EntryType
 	Size uint64
 	Time time.Time
+
+	// Only set by machine-readable listings (MLSD/MLST, RFC 3659)
+	Perm   string            // perm fact, e.g. "adfrw"
+	Unique string            // unique fact, identifies the file on the server
+	Mode   os.FileMode       // permission bits of the unix.mode fact
+	Facts  map[string]string // all facts with lower-case names
+}
+
+// FileName returns the name of the entry. The target, which is appended to
+// the name of a link with " -> " by the LIST of Unix servers, is removed.
+func (e *Entry) FileName() string {
+	if e.Type == EntryTypeLink {
+		if i := strings.Index(e.Name, " -> "); i >= 0 {
+			return e.Name[:i]
+		}
+	}
+	return e.Name
 }
 
 func (e *Entry) SetSize(str string) (err error) {
@@ -44,3 +62,41 @@ func (e *Entry) SetTime(fields []string) (err error) {
 	e.Time, err = time.Parse("_2 Jan 06 15:04 MST", timeStr)
 	return
 }
+
+// SetFact sets a fact of a machine-readable listing (RFC 3659) to the entry.
+// Fact names are case-insensitive, unknown facts are only kept in Facts.
+func (e *Entry) SetFact(name, value string) (err error) {
+	name = strings.ToLower(name)
+	if e.Facts == nil {
+		e.Facts = make(map[string]string)
+	}
+	e.Facts[name] = value
+
+	switch name {
+	case "type":
+		switch strings.ToLower(value) {
+		case "dir", "cdir", "pdir":
+			e.Type = EntryTypeFolder
+		case "file":
+			e.Type = EntryTypeFile
+		default:
+			if strings.HasPrefix(strings.ToLower(value), "os.unix=slink") {
+				e.Type = EntryTypeLink
+			}
+		}
+	case "size", "sizd":
+		err = e.SetSize(value)
+	case "modify":
+		// The time value may contain fractions of a second
+		e.Time, err = time.Parse("20060102150405", value)
+	case "perm":
+		e.Perm = value
+	case "unique":
+		e.Unique = value
+	case "unix.mode":
+		var mode uint64
+		mode, err = strconv.ParseUint(value, 8, 32)
+		e.Mode = os.FileMode(mode) & os.ModePerm
+	}
+	return
+}
@@ -0,0 +1,41 @@
+package ftpq
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestAbortRetr(t *testing.T) {
+	mock := newFtpMock(t)
+	subC := newMockSubConn(t, mock)
+
+	r, err := subC.Retr("endless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadFull(r, make([]byte, 4096))
+	if err != nil {
+		t.Error(err)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Both replies of the abort must be read
+	err = subC.NoOp()
+	if err != nil {
+		t.Error(err)
+	}
+
+	subC.Quit()
+
+	// Wait for the streams to close
+	mock.Wait()
+
+	expected := []string{"HELLO", "FEAT", "USER", "PASS", "TYPE", "FEAT", "RETR", "ABOR", "NOOP", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
@@ -0,0 +1,316 @@
+package ftpq
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lucas-clemente/quic-go"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ftpMock is a FTP server for the tests, which is connected to the client by
+// an in-memory QUIC session, see mockSession.
+type ftpMock struct {
+	t           *testing.T
+	commands    []string                        // list of received commands
+	stored      []byte                          // data of the last STOR
+	uniStreams  chan quic.ReceiveStream         // data streams opened by the server
+	sendStreams map[quic.StreamID]net.Conn      // server ends of the data streams opened by the client
+	nextID      map[quic.StreamID]quic.StreamID // next stream ID by its type, the lowest two bits
+	holdStreams bool                            // the data streams of RETR are announced, but opened after ABOR
+	lock        sync.Mutex                      // for the parallel sub connections
+	sync.WaitGroup
+}
+
+func newFtpMock(t *testing.T) *ftpMock {
+	return &ftpMock{
+		t:           t,
+		uniStreams:  make(chan quic.ReceiveStream, MaxStreamsPerSession),
+		sendStreams: make(map[quic.StreamID]net.Conn),
+		// client initiated bidirectional, client initiated and server
+		// initiated unidirectional streams
+		nextID: map[quic.StreamID]quic.StreamID{0: 0, 2: 2, 3: 3},
+	}
+}
+
+// dial returns a connection to the mock
+func (mock *ftpMock) dial() *ServerConn {
+	return &ServerConn{
+		dataRetriveStreams: make(map[quic.StreamID]quic.ReceiveStream),
+		quicSession:        &mockSession{mock: mock},
+	}
+}
+
+// mockListings contains the MLSD lines of the directories of the mock beside
+// the current one, the files contain "welcome"
+var mockListings = map[string]string{
+	"tree":     "type=cdir;modify=20150813175250; /tree\r\ntype=pdir;modify=20150813175250; /\r\ntype=file;size=7;modify=20150813175250; a.txt\r\ntype=dir;modify=20150813175250; sub\r\n",
+	"tree/sub": "type=cdir;modify=20150813175250; /tree/sub\r\ntype=pdir;modify=20150813175250; /tree\r\ntype=file;size=7;modify=20150813175250; b.txt\r\n",
+}
+
+// newStream returns both ends of a new stream of the type
+func (mock *ftpMock) newStream(streamType quic.StreamID) (client *mockStream, server net.Conn) {
+	mock.lock.Lock()
+	id := mock.nextID[streamType]
+	mock.nextID[streamType] += 4
+	mock.lock.Unlock()
+
+	clientEnd, serverEnd := net.Pipe()
+	return &mockStream{conn: clientEnd, id: id}, serverEnd
+}
+
+// mockSession implements the methods of quic.Session, which are used by the
+// client, for the mock.
+type mockSession struct {
+	quic.Session
+	mock *ftpMock
+}
+
+func (s *mockSession) OpenStreamSync() (quic.Stream, error) {
+	client, server := s.mock.newStream(0)
+	s.mock.Add(1)
+	go s.mock.serve(server)
+	return client, nil
+}
+
+func (s *mockSession) OpenUniStreamSync() (quic.SendStream, error) {
+	client, server := s.mock.newStream(2)
+	s.mock.lock.Lock()
+	s.mock.sendStreams[client.id] = server
+	s.mock.lock.Unlock()
+	return client, nil
+}
+
+func (s *mockSession) AcceptUniStream() (quic.ReceiveStream, error) {
+	stream, ok := <-s.mock.uniStreams
+	if !ok {
+		return nil, errors.New("session closed")
+	}
+	return stream, nil
+}
+
+// mockStream is the client end of a stream of the mock session
+type mockStream struct {
+	quic.Stream
+	conn net.Conn
+	id   quic.StreamID
+}
+
+func (s *mockStream) StreamID() quic.StreamID {
+	return s.id
+}
+
+func (s *mockStream) Read(p []byte) (int, error) {
+	return s.conn.Read(p)
+}
+
+func (s *mockStream) Write(p []byte) (int, error) {
+	return s.conn.Write(p)
+}
+
+func (s *mockStream) Close() error {
+	return s.conn.Close()
+}
+
+func (s *mockStream) CancelRead(quic.ErrorCode) error {
+	return s.conn.Close()
+}
+
+func (s *mockStream) CancelWrite(quic.ErrorCode) error {
+	return s.conn.Close()
+}
+
+func (s *mockStream) SetDeadline(t time.Time) error {
+	return s.conn.SetDeadline(t)
+}
+
+func (s *mockStream) SetReadDeadline(t time.Time) error {
+	return s.conn.SetReadDeadline(t)
+}
+
+func (s *mockStream) SetWriteDeadline(t time.Time) error {
+	return s.conn.SetWriteDeadline(t)
+}
+
+// serve handles a control stream
+func (mock *ftpMock) serve(conn net.Conn) {
+	defer mock.Done()
+	defer conn.Close()
+
+	proto := textproto.NewConn(conn)
+	var dataStream net.Conn
+	var transferDone chan struct{}
+	var heldStream quic.ReceiveStream
+	var restOffset int
+
+	for {
+		command, err := proto.ReadLine()
+		if err != nil {
+			return
+		}
+
+		// Strip the arguments
+		argument := ""
+		if i := strings.Index(command, " "); i > 0 {
+			argument = command[i+1:]
+			command = command[:i]
+		}
+
+		// Append to list of received commands
+		mock.lock.Lock()
+		mock.commands = append(mock.commands, command)
+		mock.lock.Unlock()
+
+		switch command {
+		case "HELLO":
+			proto.Writer.PrintfLine("220 FTP Server ready.")
+		case "FEAT":
+			proto.Writer.PrintfLine("211-Features:\r\n SIZE\r\n REST STREAM\r\n MLST type*;size*;modify*;\r\n211 End")
+		case "USER":
+			proto.Writer.PrintfLine("331 Please send your password")
+		case "PASS":
+			proto.Writer.PrintfLine("230 Access granted")
+		case "TYPE":
+			proto.Writer.PrintfLine("200 Type set ok")
+		case "CWD":
+			// Slow reply to test interrupted commands
+			time.Sleep(200 * time.Millisecond)
+			proto.Writer.PrintfLine("250 Directory successfully changed.")
+		case "NOOP":
+			proto.Writer.PrintfLine("200 NOOP ok.")
+		case "SIZE":
+			proto.Writer.PrintfLine("213 7")
+		case "REST":
+			restOffset, err = strconv.Atoi(argument)
+			if err != nil {
+				mock.t.Error(err)
+				return
+			}
+			proto.Writer.PrintfLine("350 Restarting at %d.", restOffset)
+		case "PWD":
+			proto.Writer.PrintfLine("257 \"/\" is the current directory")
+		case "MLST":
+			facts := "type=file;size=7;modify=20150813175250;"
+			if _, ok := mockListings[argument]; ok {
+				facts = "type=dir;modify=20150813175250;"
+			}
+			proto.Writer.PrintfLine("250-Listing %s\r\n %s %s\r\n250 End", argument, facts, argument)
+		case "STOR":
+			// The ID of the data stream precedes the path
+			var id quic.StreamID
+			_, err = fmt.Sscanf(argument, "%d ", &id)
+			if err != nil {
+				mock.t.Error(err)
+				return
+			}
+			mock.lock.Lock()
+			dataStream = mock.sendStreams[id]
+			delete(mock.sendStreams, id)
+			mock.lock.Unlock()
+			if dataStream == nil {
+				proto.Writer.PrintfLine("425 Unknown data stream %d.", id)
+				break
+			}
+			proto.Writer.PrintfLine("150 Ok to send data.")
+			data, err := ioutil.ReadAll(dataStream)
+			if err != nil {
+				mock.t.Error(err)
+				return
+			}
+			mock.lock.Lock()
+			mock.stored = append(mock.stored[:restOffset], data...)
+			mock.lock.Unlock()
+			restOffset = 0
+			proto.Writer.PrintfLine("226 Transfer complete.")
+		case "RETR", "MLSD":
+			client, server := mock.newStream(3)
+			dataStream = server
+			proto.Writer.PrintfLine("150 %d Opening data stream.", client.id)
+			if mock.holdStreams {
+				// The stream is opened after ABOR
+				heldStream = client
+				transferDone = make(chan struct{})
+				close(transferDone)
+				break
+			}
+			mock.uniStreams <- client
+
+			if argument == "endless" {
+				// Send data until the stream is canceled
+				transferDone = make(chan struct{})
+				go func() {
+					defer close(transferDone)
+					buf := make([]byte, 1024)
+					for {
+						if _, err := dataStream.Write(buf); err != nil {
+							return
+						}
+					}
+				}()
+				break
+			}
+			data := []byte("welcome")[restOffset:]
+			restOffset = 0
+			if command == "MLSD" {
+				data = []byte("type=file;size=7;modify=20150813175250; welcome.msg\r\ntype=dir;modify=20150813175250; pub\r\n")
+				if listing, ok := mockListings[argument]; ok {
+					data = []byte(listing)
+				}
+			}
+			dataStream.Write(data)
+			dataStream.Close()
+			proto.Writer.PrintfLine("226 Transfer complete.")
+		case "ABOR":
+			dataStream.Close()
+			if transferDone == nil {
+				// The transfer was already complete
+				proto.Writer.PrintfLine("226 ABOR successful.")
+				break
+			}
+			<-transferDone
+			transferDone = nil
+			if heldStream != nil {
+				mock.uniStreams <- heldStream
+				heldStream = nil
+			}
+			proto.Writer.PrintfLine("426 Failure writing network stream.")
+			proto.Writer.PrintfLine("226 ABOR successful.")
+		case "QUIT":
+			proto.Writer.PrintfLine("221 Goodbye.")
+			return
+		default:
+			mock.t.Error("unknown command:", command)
+			return
+		}
+	}
+}
+
+// newMockSubConn opens a logged in sub connection to the mock
+func newMockSubConn(t *testing.T, mock *ftpMock) *ServerSubConn {
+	subC, _, err := mock.dial().GetNewSubConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = subC.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subC
+}
+
+// readAll reads and closes the data of a transfer
+func readAll(r io.ReadCloser) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	closeErr := r.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return data, err
+}
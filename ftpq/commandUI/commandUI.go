@@ -1,7 +1,11 @@
 // Commandline for the QUIC-FTP-Client to access an QUIC-FTP-Server
-// Arguments for starting the client are -cert (mandatory), -host and -port
-// to specify the servers TLS-/X.509-certificate (filename), his hostname and
-// controlport.
+// Arguments for starting the client are -cert, -host and -port
+// to specify the servers TLS-/X.509-certificate or CA (filename), his hostname and
+// controlport. Without -cert the certificate is verified with the system roots.
+// With -pin the certificate must have one of the comma separated SHA-256
+// fingerprints, -insecure disables the verification.
+// For mutual TLS -clientcert and -clientkey specify the certificate and the
+// private key of the client, -keypass the password of an encrypted key.
 
 package main
 
@@ -13,7 +17,6 @@ import (
 	"github.com/attenberger/ftps_qftp-client"
 	"github.com/attenberger/ftps_qftp-client/ftpq"
 	"io"
-	"log"
 	"os"
 	"os/user"
 	"strconv"
@@ -21,21 +24,36 @@ import (
 	"time"
 )
 
+// consoleReader reads the commands and the answers of the user
+var consoleReader = bufio.NewReader(os.Stdin)
+
 func main() {
 	// Parse commandline flags
 	var (
-		port = flag.Int("port", 2120, "Port")
-		host = flag.String("host", "localhost", "Port")
-		cert = flag.String("cert", "", "Path to server certificate for TLS")
+		port       = flag.Int("port", 2120, "Port")
+		host       = flag.String("host", "localhost", "Port")
+		cert       = flag.String("cert", "", "Path to server certificate or CA for TLS")
+		pin        = flag.String("pin", "", "Comma separated SHA-256 fingerprints of accepted server certificates")
+		insecure   = flag.Bool("insecure", false, "Accept every server certificate")
+		clientcert = flag.String("clientcert", "", "Path to client certificate for mutual TLS")
+		clientkey  = flag.String("clientkey", "", "Path to private key of the client certificate")
+		keypass    = flag.String("keypass", "", "Password of an encrypted private key")
 	)
 	flag.Parse()
-	messageAboutMissingParameters := ""
-	if *cert == "" {
-		messageAboutMissingParameters = messageAboutMissingParameters + "Please set a certificatefile for the server with -cert\n"
-	}
-	if messageAboutMissingParameters != "" {
-		log.Fatalf(messageAboutMissingParameters)
-	}
+	tlsOptions := ftps_qftp_client.TLSOptions{}
+	switch {
+	case *insecure:
+		tlsOptions.Trust = ftps_qftp_client.TrustInsecure
+	case *pin != "":
+		tlsOptions.Trust = ftps_qftp_client.TrustPinned
+		tlsOptions.Pins = strings.Split(*pin, ",")
+	case *cert != "":
+		tlsOptions.Trust = ftps_qftp_client.TrustCAFile
+		tlsOptions.CAFile = *cert
+	}
+	tlsOptions.CertFile = *clientcert
+	tlsOptions.KeyFile = *clientkey
+	tlsOptions.KeyPassword = *keypass
 
 	// set working directory
 	currentUser, err := user.Current()
@@ -49,10 +67,9 @@ func main() {
 
 	// prepare necessary utils
 	commandMap := generateFunctionsMap()
-	consoleReader := bufio.NewReader(os.Stdin)
 
 	// setup ftp connection
-	connection, err := ftpq.DialTimeout(*host+":"+strconv.Itoa(*port), time.Second*30, *cert)
+	connection, err := ftpq.DialWithConfig(*host+":"+strconv.Itoa(*port), ftpq.DialConfig{Timeout: time.Second * 30, TLS: tlsOptions})
 	if err != nil {
 		fmt.Println("Error opening connection to server: " + err.Error())
 		return
@@ -63,9 +80,7 @@ func main() {
 		return
 	}
 	fmt.Println(greeting)
-
-	username := ""
-	password := ""
+	subConnection.SetProgressFunc(printProgress)
 
 	for {
 		// Read Command from Commandline
@@ -91,24 +106,15 @@ func main() {
 			fmt.Println("  Available commands:")
 			fmt.Println("  HELP")
 			fmt.Println("  CLD")
-			fmt.Println("  MTRAN")
 			for commandname := range commandMap {
 				fmt.Println("  " + commandname)
 			}
-		} else if commandParts[0] == "MTRAN" {
-			err = multipleTransfer(connection, subConnection, username, password, commandParts[1:]...)
-			if err != nil {
-				fmt.Println(err.Error())
-			}
 		} else {
 			function, available := commandMap[commandParts[0]]
 			if available {
 				err = function(subConnection, commandParts[1:]...)
 				if err != nil {
 					fmt.Println(err.Error())
-				} else if commandParts[0] == "LOGIN" {
-					username = commandParts[1]
-					password = commandParts[2]
 				}
 			} else {
 				fmt.Println("Command at this client not available.")
@@ -120,98 +126,31 @@ func main() {
 	}
 }
 
-// MultipleTransfer issues parallel FTP commands in parallel connections to store multiple files
-// to the remote FTP server.
-func multipleTransfer(connection *ftpq.ServerConn, subConnection *ftpq.ServerSubConn, username string, password string, parameters ...string) error {
-	if len(parameters) < 4 || len(parameters)%3 != 1 {
-		return errors.New("MTRAN needs at least four parameters. The first has to be the number of parallel subConnection, " +
-			"the rest each a triple of transferdirection, local- and remotepath. Transferdirection is indicated by \"<\" " +
-			" (retrieve from Server) and \">\" (store at server).")
-	}
-	parallelConnection, err := strconv.Atoi(parameters[0])
-	if err != nil {
-		return errors.New("Error converting number of parallel connections. " + err.Error())
-	}
-	tasks := make([]TransferTask, 0, (len(parameters)-1)/3)
-	for i := 1; i < len(parameters); i = i + 3 {
-		var direction TransferDirction
-		switch parameters[i] {
-		case "<":
-			direction = Retrieve
-		case ">":
-			direction = Store
-		default:
-			return errors.New(parameters[i] + " is not a vaild transfer direction. \"<\" or \">\" expected.")
-		}
-		tasks = append(tasks, NewTransferTask(direction, parameters[i+1], parameters[i+2]))
-	}
-	currentdirctory, err := subConnection.CurrentDir()
-	if err != nil {
-		return err
-	}
+// Generates a map of functions for all supported commands of the userinterface.
+// The commands are not necessarily FTP-Commands.
+func generateFunctionsMap() map[string]func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
 
-	// Not more connections than files to store or negative
-	if len(tasks) < parallelConnection || parallelConnection < 0 {
-		parallelConnection = len(tasks)
-	}
+	var functions = make(map[string]func(subConnection *ftpq.ServerSubConn, parameters ...string) error)
 
-	// Write all tasks to the channel including the finishing message
-	taskChannel := make(chan TransferTask, len(tasks)+parallelConnection)
-	returnChannel := make(chan error, len(tasks))
-	for _, task := range tasks {
-		task.finished = false
-		taskChannel <- task
-	}
-	for i := 0; i < parallelConnection; i++ {
-		taskChannel <- TransferTask{finished: true}
-	}
+	functions["APPE"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) != 2 {
+			return errors.New("APPE needs two parameter.")
+		}
+		localpath := parameters[0]
+		remotepath := parameters[1]
 
-	// Start goroutines for parallel connections and provide the channels for communication
-	for i := 0; i < parallelConnection; i++ {
-		subC, _, err := connection.GetNewSubConn()
+		file, err := os.Open(localpath)
+		defer file.Close()
 		if err != nil {
-			fmt.Println(err)
-		} else {
-			go parallelTransfer(subC, username, password, currentdirctory, taskChannel, returnChannel)
-		}
-	}
-	// The main connection is also used for parallel transfer
-	/*for {
-		task := <-taskChannel
-		if task.finished {
-			break
-		} else if task.direction == Store {
-			returnChannel <- c.mainSubConn.parallelStorTask(task)
-		} else if task.direction == Retrieve {
-			returnChannel <- c.mainSubConn.parallelRetrTask(task)
-		} else {
-			returnChannel <- errors.New("Unknown direction for transfer.")
-		}
-	}*/
-
-	errorMessage := ""
-	// Wait for replais of the STORs in the goroutines
-	for normalReplay, goRoutineResetReply := 0, 0; normalReplay < len(tasks) && goRoutineResetReply < parallelConnection; normalReplay++ {
-		replay := <-returnChannel
-		if replay != nil {
-			errorMessage = errorMessage + "\n" + replay.Error()
-			if strings.HasPrefix("Go routine reset.", replay.Error()) {
-				goRoutineResetReply++
-			}
+			return errors.New("Error while opening the local file. " + err.Error())
+		}
+
+		err = subConnection.Append(remotepath, file)
+		if err != nil {
+			return errors.New("Error while appending file to server. " + err.Error())
 		}
-	}
-	if errorMessage == "" {
 		return nil
-	} else {
-		return errors.New(errorMessage)
 	}
-}
-
-// Generates a map of functions for all supported commands of the userinterface.
-// The commands are not necessarily FTP-Commands.
-func generateFunctionsMap() map[string]func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
-
-	var functions = make(map[string]func(subConnection *ftpq.ServerSubConn, parameters ...string) error)
 
 	functions["CDUP"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
 		if len(parameters) != 0 {
@@ -251,6 +190,22 @@ func generateFunctionsMap() map[string]func(subConnection *ftpq.ServerSubConn, p
 		return nil
 	}
 
+	functions["HASH"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) < 1 || len(parameters) > 2 {
+			return errors.New("Please use HASH-command in the following pattern \"HASH Path [SHA-256|SHA-1|MD5|CRC32]\".")
+		}
+		algorithm := ftps_qftp_client.HashSHA256
+		if len(parameters) == 2 {
+			algorithm = ftps_qftp_client.HashAlgorithm(strings.ToUpper(parameters[1]))
+		}
+		checksum, err := subConnection.Hash(parameters[0], algorithm)
+		if err != nil {
+			return err
+		}
+		fmt.Println("  " + string(algorithm) + " " + checksum)
+		return nil
+	}
+
 	functions["LIST"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
 		var entrys []*ftps_qftp_client.Entry
 		var err error
@@ -266,18 +221,7 @@ func generateFunctionsMap() map[string]func(subConnection *ftpq.ServerSubConn, p
 			return err
 		}
 		for _, entry := range entrys {
-			var typeChar string
-			switch entry.Type {
-			case ftps_qftp_client.EntryTypeFile:
-				typeChar = "-"
-			case ftps_qftp_client.EntryTypeFolder:
-				typeChar = "d"
-			case ftps_qftp_client.EntryTypeLink:
-				typeChar = "l"
-			default:
-				typeChar = "?"
-			}
-			fmt.Printf("  %s %12d %20s %s\n", typeChar, entry.Size, entry.Time.String(), entry.Name)
+			printEntry(entry)
 		}
 		return nil
 	}
@@ -296,13 +240,174 @@ func generateFunctionsMap() map[string]func(subConnection *ftpq.ServerSubConn, p
 		return subConnection.Logout()
 	}
 
+	functions["MDTM"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("MDTM needs one parameter.")
+		}
+		modTime, err := subConnection.ModTime(parameters[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println("  " + modTime.String())
+		return nil
+	}
+
+	functions["MFMT"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) != 2 {
+			return errors.New("Please use MFMT-command in the following pattern \"MFMT YYYYMMDDHHMMSS Path\".")
+		}
+		modTime, err := time.Parse("20060102150405", parameters[0])
+		if err != nil {
+			return errors.New("Error converting the time. " + err.Error())
+		}
+		return subConnection.SetModTime(parameters[1], modTime)
+	}
+
+	functions["MGET"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) < 3 || len(parameters) > 4 || parameters[0] != "-r" {
+			return errors.New("Please use MGET-command in the following pattern \"MGET -r Remotedir Localdir [Parallel]\", " +
+				"it retrieves the directory tree with the given number of parallel connections.")
+		}
+		opts := ftps_qftp_client.DirTransferOptions{Parallel: 1}
+		if len(parameters) == 4 {
+			var err error
+			opts.Parallel, err = strconv.Atoi(parameters[3])
+			if err != nil {
+				return errors.New("Error converting number of parallel connections. " + err.Error())
+			}
+		}
+		return subConnection.DownloadDir(parameters[1], parameters[2], opts)
+	}
+
 	functions["MKD"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) == 2 && parameters[0] == "-p" {
+			return subConnection.MakeDirAll(parameters[1])
+		}
 		if len(parameters) < 1 {
-			return errors.New("MKD needs one parameter.")
+			return errors.New("MKD needs one parameter, with -p the missing parent directories are created.")
 		}
 		return subConnection.MakeDir(parameters[0])
 	}
 
+	functions["MPUT"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		opts := ftps_qftp_client.DirTransferOptions{Parallel: 1}
+		recursive := false
+		for len(parameters) > 0 && strings.HasPrefix(parameters[0], "-") {
+			switch parameters[0] {
+			case "-r":
+				recursive = true
+			case "-L":
+				opts.Symlinks = ftps_qftp_client.FollowSymlinks
+			default:
+				return errors.New("Unknown option " + parameters[0] + ".")
+			}
+			parameters = parameters[1:]
+		}
+		if !recursive || len(parameters) < 2 || len(parameters) > 3 {
+			return errors.New("Please use MPUT-command in the following pattern \"MPUT -r [-L] Localdir Remotedir [Parallel]\", " +
+				"it stores the directory tree with the given number of parallel connections, -L follows symbolic links.")
+		}
+		if len(parameters) == 3 {
+			var err error
+			opts.Parallel, err = strconv.Atoi(parameters[2])
+			if err != nil {
+				return errors.New("Error converting number of parallel connections. " + err.Error())
+			}
+		}
+		return subConnection.UploadDir(parameters[0], parameters[1], opts)
+	}
+
+	functions["MTRAN"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		resume := len(parameters) > 0 && parameters[0] == "-c"
+		if resume {
+			parameters = parameters[1:]
+		}
+		if len(parameters) < 4 || len(parameters)%3 != 1 {
+			return errors.New("MTRAN needs at least four parameters. The first has to be the number of parallel subConnection, " +
+				"the rest each a triple of transferdirection, local- and remotepath. Transferdirection is indicated by \"<\" " +
+				" (retrieve from Server) and \">\" (store at server). With -c as first parameter interrupted transfers are continued.")
+		}
+		parallelConnection, err := strconv.Atoi(parameters[0])
+		if err != nil {
+			return errors.New("Error converting number of parallel connections. " + err.Error())
+		}
+		tasks := make([]ftpq.TransferTask, 0, (len(parameters)-1)/3)
+		for i := 1; i < len(parameters); i = i + 3 {
+			var direction ftpq.TransferDirction
+			switch parameters[i] {
+			case "<":
+				direction = ftpq.Retrieve
+			case ">":
+				direction = ftpq.Store
+			default:
+				return errors.New(parameters[i] + " is not a vaild transfer direction. \"<\" or \">\" expected.")
+			}
+			if resume {
+				tasks = append(tasks, ftpq.NewResumeTransferTask(direction, parameters[i+1], parameters[i+2]))
+			} else {
+				tasks = append(tasks, ftpq.NewTransferTask(direction, parameters[i+1], parameters[i+2]))
+			}
+		}
+		// MTRAN counts the additional sub connections, the main one transfers too
+		if parallelConnection >= 0 {
+			parallelConnection++
+		}
+		return subConnection.MultipleTransfer(tasks, parallelConnection)
+	}
+
+	functions["MLSD"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		var entrys []*ftps_qftp_client.Entry
+		var err error
+		switch len(parameters) {
+		case 0:
+			entrys, err = subConnection.ListMachine(".")
+		case 1:
+			entrys, err = subConnection.ListMachine(parameters[0])
+		default:
+			return errors.New("MLSD needs one or no parameter.")
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entrys {
+			printEntry(entry)
+		}
+		return nil
+	}
+
+	functions["MLST"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("MLST needs one parameter.")
+		}
+		entry, err := subConnection.Stat(parameters[0])
+		if err != nil {
+			return err
+		}
+		printEntry(entry)
+		return nil
+	}
+
+	functions["MODE"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) < 1 || len(parameters) > 2 {
+			return errors.New("Please use MODE-command in the following pattern \"MODE Z [Level]\" or \"MODE S\".")
+		}
+		switch strings.ToUpper(parameters[0]) {
+		case "S":
+			return subConnection.DisableCompression()
+		case "Z":
+			level := -1
+			if len(parameters) == 2 {
+				var err error
+				level, err = strconv.Atoi(parameters[1])
+				if err != nil || level < 1 || level > 9 {
+					return errors.New("The compression level must be between 1 and 9.")
+				}
+			}
+			return subConnection.EnableCompression(level)
+		}
+		return errors.New("Just the modes S (stream) and Z (compressed) are supported.")
+	}
+
 	functions["NLST"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
 		var entrys []string
 		var err error
@@ -357,12 +462,20 @@ func generateFunctionsMap() map[string]func(subConnection *ftpq.ServerSubConn, p
 	}
 
 	functions["RETR"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		resume := len(parameters) > 0 && parameters[0] == "-c"
+		if resume {
+			parameters = parameters[1:]
+		}
 		if len(parameters) != 2 {
-			return errors.New("RETR needs two parameter.")
+			return errors.New("Please use RETR-command in the following pattern \"RETR [-c] Localpath Remotepath\", -c continues an interrupted download.")
 		}
 		localpath := parameters[0]
 		remotepath := parameters[1]
 
+		if resume {
+			return subConnection.ResumeRetr(remotepath, localpath)
+		}
+
 		if _, err := os.Stat(localpath); os.IsExist(err) {
 			return errors.New("File with this name already exists in local folder.")
 		}
@@ -392,6 +505,33 @@ func generateFunctionsMap() map[string]func(subConnection *ftpq.ServerSubConn, p
 		return nil
 	}
 
+	functions["RM"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		recursive := len(parameters) > 0 && parameters[0] == "-r"
+		if recursive {
+			parameters = parameters[1:]
+		}
+		if len(parameters) < 1 || len(parameters) > 2 || (!recursive && len(parameters) != 1) {
+			return errors.New("Please use RM-command in the following pattern \"RM [-r] Remotepath [Parallel]\", " +
+				"-r removes the directory tree with the given number of parallel connections.")
+		}
+		if !recursive {
+			return subConnection.Delete(parameters[0])
+		}
+		parallel := 1
+		if len(parameters) == 2 {
+			var err error
+			parallel, err = strconv.Atoi(parameters[1])
+			if err != nil {
+				return errors.New("Error converting number of parallel connections. " + err.Error())
+			}
+		}
+		if !confirm("Remove " + parameters[0] + " with its whole content?") {
+			fmt.Println("  Nothing removed.")
+			return nil
+		}
+		return subConnection.RemoveAllParallel(parameters[0], parallel)
+	}
+
 	functions["RMD"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
 		if len(parameters) < 1 {
 			return errors.New("RKD needs one parameter.")
@@ -399,13 +539,89 @@ func generateFunctionsMap() map[string]func(subConnection *ftpq.ServerSubConn, p
 		return subConnection.RemoveDir(parameters[0])
 	}
 
+	functions["SYNC"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		opts := ftps_qftp_client.SyncOptions{Mode: ftps_qftp_client.SyncBidirectional, Parallel: 1}
+		for len(parameters) > 0 && strings.HasPrefix(parameters[0], "-") {
+			switch parameters[0] {
+			case "-up":
+				opts.Mode = ftps_qftp_client.SyncMirrorUpload
+			case "-down":
+				opts.Mode = ftps_qftp_client.SyncMirrorDownload
+			case "-both":
+				opts.Mode = ftps_qftp_client.SyncBidirectional
+			case "-delete":
+				opts.DeleteExtraneous = true
+			case "-n":
+				opts.DryRun = true
+			case "-hash":
+				if len(parameters) < 2 {
+					return errors.New("-hash needs the name of the algorithm.")
+				}
+				opts.Hash = ftps_qftp_client.HashAlgorithm(strings.ToUpper(parameters[1]))
+				parameters = parameters[1:]
+			default:
+				return errors.New("Unknown option " + parameters[0] + ".")
+			}
+			parameters = parameters[1:]
+		}
+		if len(parameters) < 2 || len(parameters) > 3 {
+			return errors.New("Please use SYNC-command in the following pattern \"SYNC [-up|-down|-both] [-delete] [-n] [-hash Algorithm] Localdir Remotedir [Parallel]\", " +
+				"-up and -down mirror in one direction, -both copies the newer files, -delete removes extraneous files of a mirror, -n only shows the actions.")
+		}
+		if len(parameters) == 3 {
+			var err error
+			opts.Parallel, err = strconv.Atoi(parameters[2])
+			if err != nil {
+				return errors.New("Error converting number of parallel connections. " + err.Error())
+			}
+		}
+		report, err := subConnection.Sync(parameters[0], parameters[1], opts)
+		if err != nil {
+			return err
+		}
+		for _, action := range report.Actions {
+			fmt.Println("  " + action.Kind.String() + " " + action.Path + " (" + action.Reason + ")")
+		}
+		if len(report.Actions) == 0 {
+			fmt.Println("  The directories are synchronized.")
+		}
+		if len(report.Errors) > 0 {
+			return &ftps_qftp_client.MultipleErrors{Errors: report.Errors}
+		}
+		return nil
+	}
+
+	functions["SIZE"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("SIZE needs one parameter.")
+		}
+		size, err := subConnection.FileSize(parameters[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  %d\n", size)
+		return nil
+	}
+
 	functions["STOR"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		resume := len(parameters) > 0 && parameters[0] == "-c"
+		if resume {
+			parameters = parameters[1:]
+		}
 		if len(parameters) != 2 {
-			return errors.New("STOR needs two parameter.")
+			return errors.New("Please use STOR-command in the following pattern \"STOR [-c] Localpath Remotepath\", -c continues an interrupted upload.")
 		}
 		localpath := parameters[0]
 		remotepath := parameters[1]
 
+		if resume {
+			err := subConnection.ResumeStor(localpath, remotepath)
+			if err != nil {
+				return errors.New("Error while writing file to server. " + err.Error())
+			}
+			return nil
+		}
+
 		file, err := os.Open(localpath)
 		defer file.Close()
 		if err != nil {
@@ -419,111 +635,120 @@ func generateFunctionsMap() map[string]func(subConnection *ftpq.ServerSubConn, p
 		return nil
 	}
 
-	return functions
-}
-
-type TransferDirction int8
-
-const (
-	Retrieve = TransferDirction(1)
-	Store    = TransferDirction(2)
-)
-
-// Task to inform a go routine which transfer should be performed
-type TransferTask struct {
-	localpath  string
-	remotepath string
-	direction  TransferDirction
-	finished   bool
-}
-
-// Creates a new TransferTask
-func NewTransferTask(direction TransferDirction, localpath string, remotepath string) TransferTask {
-	return TransferTask{localpath: localpath, remotepath: remotepath, direction: direction, finished: false}
-}
+	functions["STOU"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("STOU needs one parameter.")
+		}
 
-// Runs a parallel transfer.
-// In the taskChannel it gets the TransferTask to perform.
-// In the returnChannel it returns occured error or nil for success
-func parallelTransfer(subC *ftpq.ServerSubConn, username string, password string, dirctory string, taskChannel chan TransferTask, returnChannel chan error) {
+		file, err := os.Open(parameters[0])
+		defer file.Close()
+		if err != nil {
+			return errors.New("Error while opening the local file. " + err.Error())
+		}
 
-	defer subC.Quit()
-	// Login in
-	err := subC.Login(username, password)
-	if err != nil {
-		returnChannel <- errors.New("Go routine reset. " + err.Error())
-		return
-	}
-	// Change to directory of the main connection
-	err = subC.ChangeDir(dirctory)
-	if err != nil {
-		returnChannel <- errors.New("Go routine reset. " + err.Error())
-		return
+		name, err := subConnection.StorUnique(file)
+		if err != nil {
+			return errors.New("Error while writing file to server. " + err.Error())
+		}
+		fmt.Println("  " + name)
+		return nil
 	}
 
-	// run tasks
-	for {
-		task := <-taskChannel
-		if task.finished {
-			return
-		} else if task.direction == Store {
-			returnChannel <- parallelStorTask(task, subC)
-		} else if task.direction == Retrieve {
-			returnChannel <- parallelRetrTask(task, subC)
-		} else {
-			returnChannel <- errors.New("Unknown direction for transfer.")
+	functions["TYPE"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("Please use TYPE-command in the following pattern \"TYPE A|I\".")
 		}
+		switch strings.ToUpper(parameters[0]) {
+		case "A":
+			return subConnection.SetTransferType(ftps_qftp_client.TransferTypeASCII)
+		case "I":
+			return subConnection.SetTransferType(ftps_qftp_client.TransferTypeBinary)
+		}
+		return errors.New("Just the types A (ASCII) and I (binary) are supported.")
 	}
-}
 
-// Stores a file at the server within a parallel transfer.
-func parallelStorTask(task TransferTask, subC *ftpq.ServerSubConn) error {
-	file, err := os.Open(task.localpath)
-	defer file.Close()
-	if err != nil {
-		return errors.New("Error while opening the local file " + task.localpath + ". " + err.Error())
+	functions["VERIFY"] = func(subConnection *ftpq.ServerSubConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("Please use VERIFY-command in the following pattern \"VERIFY SHA-256|SHA-1|MD5|CRC32|OFF\".")
+		}
+		if strings.ToUpper(parameters[0]) == "OFF" {
+			return subConnection.SetTransferVerification("")
+		}
+		return subConnection.SetTransferVerification(ftps_qftp_client.HashAlgorithm(strings.ToUpper(parameters[0])))
 	}
 
-	err = subC.Stor(task.remotepath, file)
+	return functions
+}
+
+// Asks the user a yes/no question, the default is no.
+func confirm(question string) bool {
+	fmt.Print("  " + question + " [y/N] ")
+	line, _, err := consoleReader.ReadLine()
 	if err != nil {
-		return errors.New("Error while writing file " + task.localpath + " to server. " + err.Error())
+		return false
 	}
-	return nil
+	answer := strings.ToLower(strings.TrimSpace(string(line)))
+	return answer == "y" || answer == "yes"
 }
 
-// Receives a file at the server within a parallel transfer.
-func parallelRetrTask(task TransferTask, subC *ftpq.ServerSubConn) error {
-	// Check if file already exists at client
-	if _, err := os.Stat(task.localpath); os.IsExist(err) {
-		return errors.New("File with this name already exists in local folder.")
+// Draws a progress bar of a transfer or of a job with multiple files.
+func printProgress(progress ftps_qftp_client.Progress) {
+	name := progress.Path
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
 	}
-
-	// Create and open the file
-	file, err := os.Create(task.localpath)
-	if err != nil {
-		return errors.New("Error while creating the local file. " + err.Error())
+	done, total, rate, eta := progress.Done, progress.Total, progress.Rate, progress.ETA
+	finished := progress.Finished
+	if progress.Job != nil {
+		name = strconv.Itoa(progress.Job.Finished) + "/" + strconv.Itoa(progress.Job.Files) + " files"
+		done, total, rate, eta = progress.Job.Done, progress.Job.Total, progress.Job.Rate, progress.Job.ETA
+		finished = progress.Job.Finished == progress.Job.Files
 	}
-	defer file.Close()
 
-	// Retrieve the file and write it to the filesystem
-	reader, err := subC.Retr(task.remotepath)
-	if err != nil {
-		return err
-	}
-	_, err = io.Copy(file, reader)
-	if err != nil {
-		errortext := "Error while writing file to local file. " + err.Error()
-		err = reader.Close()
-		if err != nil {
-			errortext = errortext + " Error while closing reader from server. " + err.Error()
+	const width = 30
+	bar := ""
+	if total > 0 {
+		filled := int(done * width / total)
+		if filled > width {
+			filled = width
 		}
-		return errors.New(errortext)
+		bar = "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "] " +
+			fmt.Sprintf("%3d%% ", done*100/total)
 	}
+	line := fmt.Sprintf("\r  %-20.20s %s%s %s/s", name, bar, formatBytes(float64(done)), formatBytes(rate))
+	if eta >= 0 && !finished {
+		line = line + fmt.Sprintf(" ETA %d:%02d", int(eta.Minutes()), int(eta.Seconds())%60)
+	}
+	// Overwrite the rest of a longer previous line
+	fmt.Printf("%-100s", line)
+	if finished {
+		fmt.Println()
+	}
+}
 
-	// Finalize retrieve of the file
-	err = reader.Close()
-	if err != nil {
-		return errors.New(" Error while closing reader from server. " + err.Error())
+// Formats a number of bytes with a binary unit.
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
 	}
-	return nil
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
+
+// Prints an entry of a directory listing in a format similar to "ls -l".
+func printEntry(entry *ftps_qftp_client.Entry) {
+	var typeChar string
+	switch entry.Type {
+	case ftps_qftp_client.EntryTypeFile:
+		typeChar = "-"
+	case ftps_qftp_client.EntryTypeFolder:
+		typeChar = "d"
+	case ftps_qftp_client.EntryTypeLink:
+		typeChar = "l"
+	default:
+		typeChar = "?"
+	}
+	fmt.Printf("  %s %12d %20s %s\n", typeChar, entry.Size, entry.Time.String(), entry.Name)
 }
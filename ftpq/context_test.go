@@ -0,0 +1,104 @@
+package ftpq
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestContextInterruptsCommand(t *testing.T) {
+	mock := newFtpMock(t)
+	subC := newMockSubConn(t, mock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := subC.ChangeDirContext(ctx, "incoming")
+	if err != context.DeadlineExceeded {
+		t.Errorf("ChangeDirContext returned err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The late reply to CWD must not be taken as reply to NOOP
+	err = subC.NoOp()
+	if err != nil {
+		t.Error(err)
+	}
+
+	subC.Quit()
+
+	// Wait for the streams to close
+	mock.Wait()
+
+	expected := []string{"HELLO", "FEAT", "USER", "PASS", "TYPE", "FEAT", "CWD", "NOOP", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
+
+func TestContextCancelsTransfer(t *testing.T) {
+	mock := newFtpMock(t)
+	subC := newMockSubConn(t, mock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := subC.RetrContext(ctx, "endless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadFull(r, make([]byte, 4096))
+	if err != nil {
+		t.Error(err)
+	}
+	cancel()
+	_, err = io.Copy(ioutil.Discard, r)
+	if err != context.Canceled {
+		t.Errorf("Read returned err = %v, want %v", err, context.Canceled)
+	}
+	r.Close()
+
+	// The replies of the aborted transfer are read before the next command
+	err = subC.NoOp()
+	if err != nil {
+		t.Error(err)
+	}
+
+	subC.Quit()
+
+	// Wait for the streams to close
+	mock.Wait()
+
+	expected := []string{"HELLO", "FEAT", "USER", "PASS", "TYPE", "FEAT", "RETR", "ABOR", "NOOP", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
+
+func TestContextInterruptsStreamAccept(t *testing.T) {
+	mock := newFtpMock(t)
+	mock.holdStreams = true
+	subC := newMockSubConn(t, mock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := subC.RetrContext(ctx, "welcome.msg")
+	if err != context.DeadlineExceeded {
+		t.Errorf("RetrContext returned err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The transfer is aborted before the next command
+	err = subC.NoOp()
+	if err != nil {
+		t.Error(err)
+	}
+
+	subC.Quit()
+
+	// Wait for the streams to close
+	mock.Wait()
+
+	expected := []string{"HELLO", "FEAT", "USER", "PASS", "TYPE", "FEAT", "RETR", "ABOR", "NOOP", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
@@ -0,0 +1,50 @@
+package ftpq
+
+import (
+	"github.com/attenberger/ftps_qftp-client"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mock := newFtpMock(t)
+	subC := newMockSubConn(t, mock)
+
+	// The listings contain the directory itself and its parent
+	err = subC.DownloadDir("tree", filepath.Join(dir, "local"), ftps_qftp_client.DirTransferOptions{Parallel: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subC.Quit()
+
+	// Wait for the streams to close
+	mock.Wait()
+
+	for _, name := range []string{"a.txt", filepath.Join("sub", "b.txt")} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "local", name))
+		if err != nil {
+			t.Error(err)
+		} else if string(data) != "welcome" {
+			t.Errorf("unexpected content of %s: %q", name, data)
+		}
+	}
+	// The directories themselves are not downloaded again
+	for name, count := range map[string]int{".": 2, "sub": 1} {
+		infos, err := ioutil.ReadDir(filepath.Join(dir, "local", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(infos) != count {
+			t.Errorf("expected %d entries in %s, got %d", count, name, len(infos))
+		}
+	}
+}
@@ -2,11 +2,10 @@
 package ftpq
 
 import (
-	"crypto/tls"
 	"crypto/x509"
-	"errors"
+	"github.com/attenberger/ftps_qftp-client"
 	"github.com/lucas-clemente/quic-go"
-	"io/ioutil"
+	"net"
 	"net/textproto"
 	"strconv"
 	"sync"
@@ -17,6 +16,8 @@ const (
 	MaxStreamsPerSession = 3      // like default in vsftpd // but separate limit for uni- and bidirectional streams
 	MaxStreamFlowControl = 212992 // like OpenSuse TCP /proc/sys/net/core/rmem_max
 	KeepAlive            = true
+
+	dataStreamCanceled = 0 // application error code to cancel a data stream
 )
 
 // ServerConn represents the connection to a remote FTP server.
@@ -26,6 +27,20 @@ type ServerConn struct {
 	structAccessMutex     sync.Mutex
 	dataStreamAcceptMutex sync.Mutex
 	dataStreamOpenMutex   sync.Mutex
+
+	// The data streams are accepted by acceptDataStreams, all protected by
+	// dataStreamAcceptMutex
+	acceptingDataStreams bool
+	dataStreamAccepted   chan struct{}          // closed and replaced, when a stream is accepted
+	dataStreamAcceptErr  error                  // the session is closed
+	nextDataStreamID     quic.StreamID          // all lower streams were accepted
+	canceledDataStreams  map[quic.StreamID]bool // streams of canceled commands, canceled when accepted
+}
+
+// DialConfig configures the connection to the FTP server.
+type DialConfig struct {
+	Timeout time.Duration               // timeout for the handshake, 0 for the default
+	TLS     ftps_qftp_client.TLSOptions // verification of the server certificate
 }
 
 // Connect is an alias to Dial, for backward compatibility
@@ -39,20 +54,50 @@ func Dial(addr string, certfile string) (*ServerConn, error) {
 }
 
 // DialTimeout initializes the connection to the specified ftp server address.
+// The certificate of the server is verified with the CAs or the self-signed
+// certificate in certfile, or with the system roots if certfile is empty.
 //
 // It is generally followed by a call to Login() as most FTP commands require
 // an authenticated user.
 func DialTimeout(addr string, timeout time.Duration, certfile string) (*ServerConn, error) {
+	config := DialConfig{Timeout: timeout}
+	if certfile != "" {
+		config.TLS = ftps_qftp_client.TLSOptions{Trust: ftps_qftp_client.TrustCAFile, CAFile: certfile}
+	}
+	return DialWithConfig(addr, config)
+}
+
+// DialWithConfig initializes the connection to the specified ftp server address
+// with the given configuration.
+// A rejected certificate of the server is returned as
+// *ftps_qftp_client.CertificateError.
+func DialWithConfig(addr string, config DialConfig) (*ServerConn, error) {
+	hostname, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
 
-	tlsConfig, err := generateTLSConfig(certfile)
+	tlsConfig, err := ftps_qftp_client.NewTLSConfig(hostname, config.TLS)
 	if err != nil {
 		return nil, err
 	}
+	// Remember a rejected certificate, the handshake error of QUIC does not
+	// contain the CertificateError
+	var certErr error
+	if verify := tlsConfig.VerifyPeerCertificate; verify != nil {
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			certErr = verify(rawCerts, verifiedChains)
+			return certErr
+		}
+	}
 
-	quicConfig := generateQUICConfig(timeout)
+	quicConfig := generateQUICConfig(config.Timeout)
 
 	quicSession, err := quic.DialAddr(addr, tlsConfig, quicConfig)
 	if err != nil {
+		if certErr != nil {
+			return nil, certErr
+		}
 		return nil, err
 	}
 
@@ -65,22 +110,6 @@ func DialTimeout(addr string, timeout time.Duration, certfile string) (*ServerCo
 	return c, nil
 }
 
-// Generates from the specified certifiate file a tls configuration
-func generateTLSConfig(certfile string) (*tls.Config, error) {
-	tlsConfig := &tls.Config{}
-	tlsConfig.InsecureSkipVerify = true
-	certficate, err := ioutil.ReadFile(certfile)
-	if err != nil {
-		return tlsConfig, err
-	}
-	rootCAs := x509.NewCertPool()
-	if !rootCAs.AppendCertsFromPEM([]byte(certficate)) {
-		return tlsConfig, errors.New("ERROR: Fehler beim parsen des Serverzertifikats.\n")
-	}
-	tlsConfig.RootCAs = rootCAs
-	return tlsConfig, nil
-}
-
 // Generates a quic configuration
 func generateQUICConfig(timeout time.Duration) *quic.Config {
 	config := &quic.Config{}
@@ -111,7 +140,9 @@ func (c *ServerConn) GetNewSubConn() (*ServerSubConn, string, error) {
 	subC := &ServerSubConn{
 		serverConnection: c,
 		controlStream:    controlStream,
+		controlStreamRaw: controlStreamRaw,
 		features:         make(map[string]string),
+		transferType:     ftps_qftp_client.TransferTypeBinary,
 	}
 
 	code, message, err := subC.cmd(StatusReady, "HELLO")
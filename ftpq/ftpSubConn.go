@@ -2,12 +2,18 @@ package ftpq
 
 import (
 	"bufio"
+	"compress/zlib"
+	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/attenberger/ftps_qftp-client"
 	"github.com/lucas-clemente/quic-go"
+	"hash"
 	"io"
 	"net/textproto"
+	"os"
+	pathpkg "path"
 	"strconv"
 	"strings"
 	"time"
@@ -18,17 +24,53 @@ import (
 type ServerSubConn struct {
 	serverConnection *ServerConn
 	controlStream    *textproto.Conn
+	controlStreamRaw quic.Stream
 	features         map[string]string
+	username         string // for the login of additional sub connections
+	password         string
+	transferType     ftps_qftp_client.TransferType
+	compression      bool // MODE Z
+	compressionLevel int
+	hashAlgorithm    ftps_qftp_client.HashAlgorithm // selected with OPTS HASH
+	verifyAlgorithm  ftps_qftp_client.HashAlgorithm // for the verification of transfers
+	pendingReplies   int                            // replies of interrupted commands, which are still to read
+	progressFunc     ftps_qftp_client.ProgressFunc  // reports the progress of the transfers, nil if not reported
 }
 
 // response represent a data-connection
 type response struct {
 	conn quic.ReceiveStream
 	c    *ServerSubConn
+	ctx  context.Context
+	stop func()    // stops watching ctx for the data stream
+	eof  bool      // whether the transfer is complete
+	data io.Reader // reads conn, converted in ASCII mode
+	hash hash.Hash // checksum of the read data for the verification, nil if not verified
+	path string
+
+	progress *ftps_qftp_client.ProgressReader // reports the progress, nil if not reported
+}
+
+// newResponse creates a response for the data stream, which is canceled
+// when ctx is done.
+func (subC *ServerSubConn) newResponse(ctx context.Context, stream quic.ReceiveStream) *response {
+	stop := watchContext(ctx, func() {
+		stream.CancelRead(dataStreamCanceled)
+	})
+	r := &response{conn: stream, c: subC, ctx: ctx, stop: stop, data: stream}
+	if subC.compression {
+		r.data = ftps_qftp_client.NewModeZReader(stream)
+	}
+	return r
 }
 
 // Dummy function to have the same interface as the FTPS-Client
 func (subC *ServerSubConn) AuthTLS() error {
+	return subC.AuthTLSContext(context.Background())
+}
+
+// AuthTLSContext is like AuthTLS but with a context.
+func (subC *ServerSubConn) AuthTLSContext(ctx context.Context) error {
 	return nil
 }
 
@@ -37,7 +79,12 @@ func (subC *ServerSubConn) AuthTLS() error {
 // "anonymous"/"anonymous" is a common user/password scheme for FTP servers
 // that allows anonymous read-only accounts.
 func (subC *ServerSubConn) Login(user, password string) error {
-	code, message, err := subC.cmd(-1, "USER %s", user)
+	return subC.LoginContext(context.Background(), user, password)
+}
+
+// LoginContext is like Login but with a context.
+func (subC *ServerSubConn) LoginContext(ctx context.Context, user, password string) error {
+	code, message, err := subC.cmdContext(ctx, -1, "USER %s", user)
 	if err != nil {
 		return err
 	}
@@ -45,7 +92,7 @@ func (subC *ServerSubConn) Login(user, password string) error {
 	switch code {
 	case StatusLoggedIn:
 	case StatusUserOK:
-		_, _, err = subC.cmd(StatusLoggedIn, "PASS %s", password)
+		_, _, err = subC.cmdContext(ctx, StatusLoggedIn, "PASS %s", password)
 		if err != nil {
 			return err
 		}
@@ -53,14 +100,17 @@ func (subC *ServerSubConn) Login(user, password string) error {
 		return errors.New(message)
 	}
 
-	// Switch to binary mode
-	_, _, err = subC.cmd(StatusCommandOK, "TYPE I")
+	subC.username = user
+	subC.password = password
+
+	// Binary mode, if no other type was set
+	_, _, err = subC.cmdContext(ctx, StatusCommandOK, "TYPE %c", subC.transferType)
 	if err != nil {
 		return err
 	}
 
 	// logged, check features again
-	if err = subC.Feat(); err != nil {
+	if err = subC.FeatContext(ctx); err != nil {
 		subC.Quit()
 		return err
 	}
@@ -72,7 +122,12 @@ func (subC *ServerSubConn) Login(user, password string) error {
 // the remote FTP server.
 // FEAT is described in RFC 2389
 func (subC *ServerSubConn) Feat() error {
-	code, message, err := subC.cmd(-1, "FEAT")
+	return subC.FeatContext(context.Background())
+}
+
+// FeatContext is like Feat but with a context.
+func (subC *ServerSubConn) FeatContext(ctx context.Context) error {
+	code, message, err := subC.cmdContext(ctx, -1, "FEAT")
 	if err != nil {
 		return err
 	}
@@ -122,22 +177,38 @@ func (subC *ServerSubConn) Exec(expected int, format string, args ...interface{}
 	return subC.cmd(expected, format, args...)
 }
 
+// restartError is returned by RetrFrom and StorFrom, when the server does not
+// accept the REST command.
+type restartError struct {
+	err *textproto.Error
+}
+
+func (e *restartError) Error() string {
+	return "The server did not accept the offset of the transfer. " + e.err.Error()
+}
+
+func (e *restartError) Unwrap() error {
+	return e.err
+}
+
 // cmdDataReceiveStreamFrom executes a command which require a FTP data stream to receive data.
 // Issues a REST FTP command to specify the number of bytes to skip for the transfer.
-func (subC *ServerSubConn) cmdDataReceiveStreamFrom(offset uint64, format string, args ...interface{}) (quic.ReceiveStream, error) {
+func (subC *ServerSubConn) cmdDataReceiveStreamFrom(ctx context.Context, offset uint64, format string, args ...interface{}) (quic.ReceiveStream, error) {
 	if offset != 0 {
-		_, _, err := subC.cmd(StatusRequestFilePending, "REST %d", offset)
-		if err != nil {
+		_, _, err := subC.cmdContext(ctx, StatusRequestFilePending, "REST %d", offset)
+		if protoErr, ok := err.(*textproto.Error); ok {
+			return nil, &restartError{protoErr}
+		} else if err != nil {
 			return nil, err
 		}
 	}
 
-	_, err := subC.controlStream.Cmd(format, args...)
+	err := subC.sendCmd(ctx, format, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	code, msg, err := subC.controlStream.ReadResponse(-1)
+	code, msg, err := subC.readResponse(ctx, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -154,8 +225,12 @@ func (subC *ServerSubConn) cmdDataReceiveStreamFrom(offset uint64, format string
 	}
 	streamID := quic.StreamID(streamIDUint64)
 
-	stream, err := subC.getDataRetriveStream(streamID)
+	stream, err := subC.getDataRetriveStream(ctx, streamID)
 	if err != nil {
+		if ctx.Err() != nil {
+			// The transfer was started, its stream is canceled when it arrives
+			subC.abort(ctx, func() {})
+		}
 		return nil, err
 	}
 
@@ -164,17 +239,21 @@ func (subC *ServerSubConn) cmdDataReceiveStreamFrom(offset uint64, format string
 
 // cmdDataSendStreamFrom executes a command which require a FTP data stream to receive data.
 // Issues a REST FTP command to specify the number of bytes to skip for the transfer.
-func (subC *ServerSubConn) cmdDataSendStreamFrom(offset uint64, format string, args ...interface{}) (quic.SendStream, error) {
+// It returns the data stream and the message of the preliminary reply.
+func (subC *ServerSubConn) cmdDataSendStreamFrom(ctx context.Context, offset uint64, format string, args ...interface{}) (quic.SendStream, string, error) {
 	stream, err := subC.getNewDataSendStream()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if offset != 0 {
-		_, _, err := subC.cmd(StatusRequestFilePending, "REST %d", offset)
-		if err != nil {
+		_, _, err := subC.cmdContext(ctx, StatusRequestFilePending, "REST %d", offset)
+		if protoErr, ok := err.(*textproto.Error); ok {
 			stream.Close()
-			return nil, err
+			return nil, "", &restartError{protoErr}
+		} else if err != nil {
+			stream.Close()
+			return nil, "", err
 		}
 	}
 
@@ -184,47 +263,114 @@ func (subC *ServerSubConn) cmdDataSendStreamFrom(offset uint64, format string, a
 	} else {
 		format = formatParts[0] + fmt.Sprintf(" %d ", stream.StreamID()) + formatParts[1]
 	}
-	_, err = subC.controlStream.Cmd(format, args...)
+	err = subC.sendCmd(ctx, format, args...)
 	if err != nil {
 		stream.Close()
-		return nil, err
+		return nil, "", err
 	}
 
-	code, msg, err := subC.controlStream.ReadResponse(-1)
+	code, msg, err := subC.readResponse(ctx, -1)
 	if err != nil {
 		stream.Close()
-		return nil, err
+		return nil, "", err
 	}
 	if code != StatusAlreadyOpen && code != StatusAboutToSend {
 		stream.Close()
-		return nil, &textproto.Error{Code: code, Msg: msg}
+		return nil, "", &textproto.Error{Code: code, Msg: msg}
 	}
 
-	return stream, nil
+	return stream, msg, nil
 }
 
-// openDataRetriveStream creates a new FTP data stream to retrieve.
-func (subC *ServerSubConn) getDataRetriveStream(streamID quic.StreamID) (quic.ReceiveStream, error) {
-	subC.serverConnection.dataStreamAcceptMutex.Lock()
-	defer subC.serverConnection.dataStreamAcceptMutex.Unlock()
-
+// getDataRetriveStream returns the data stream with the ID, which the server
+// opened to send data. The streams are accepted for all sub connections by
+// acceptDataStreams, waiting for the stream is interrupted when ctx is done.
+func (subC *ServerSubConn) getDataRetriveStream(ctx context.Context, streamID quic.StreamID) (quic.ReceiveStream, error) {
+	c := subC.serverConnection
+	c.dataStreamAcceptMutex.Lock()
+	defer c.dataStreamAcceptMutex.Unlock()
+
+	if !c.acceptingDataStreams {
+		c.acceptingDataStreams = true
+		c.dataStreamAccepted = make(chan struct{})
+		c.canceledDataStreams = make(map[quic.StreamID]bool)
+		go c.acceptDataStreams()
+	}
 	for {
-		stream, available := subC.serverConnection.dataRetriveStreams[streamID]
+		stream, available := c.dataRetriveStreams[streamID]
 		if available {
-			delete(subC.serverConnection.dataRetriveStreams, streamID)
+			delete(c.dataRetriveStreams, streamID)
 			return stream, nil
 		}
-		stream, err := subC.serverConnection.quicSession.AcceptUniStream()
-		if err != nil {
-			return nil, err
+		if c.dataStreamAcceptErr != nil {
+			return nil, c.dataStreamAcceptErr
 		}
-		subC.serverConnection.dataRetriveStreams[stream.StreamID()] = stream
-		if stream.StreamID() > streamID {
+		if streamID < c.nextDataStreamID {
 			return nil, errors.New("Could not get wanted stream.")
 		}
+
+		accepted := c.dataStreamAccepted
+		c.dataStreamAcceptMutex.Unlock()
+		select {
+		case <-accepted:
+			c.dataStreamAcceptMutex.Lock()
+		case <-ctx.Done():
+			c.dataStreamAcceptMutex.Lock()
+			if stream, available := c.dataRetriveStreams[streamID]; available {
+				delete(c.dataRetriveStreams, streamID)
+				stream.CancelRead(dataStreamCanceled)
+			} else {
+				c.canceledDataStreams[streamID] = true
+			}
+			return nil, ctx.Err()
+		}
 	}
 }
 
+// acceptDataStreams accepts the data streams opened by the server and keeps
+// them for getDataRetriveStream until the session is closed.
+func (c *ServerConn) acceptDataStreams() {
+	for {
+		stream, err := c.quicSession.AcceptUniStream()
+		c.dataStreamAcceptMutex.Lock()
+		if err != nil {
+			c.dataStreamAcceptErr = err
+		} else if c.canceledDataStreams[stream.StreamID()] {
+			delete(c.canceledDataStreams, stream.StreamID())
+			stream.CancelRead(dataStreamCanceled)
+		} else {
+			c.dataRetriveStreams[stream.StreamID()] = stream
+		}
+		if err == nil && stream.StreamID() >= c.nextDataStreamID {
+			c.nextDataStreamID = stream.StreamID() + 4
+		}
+		close(c.dataStreamAccepted)
+		c.dataStreamAccepted = make(chan struct{})
+		c.dataStreamAcceptMutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// abort issues an ABOR FTP command to abort the running transfer and cancels
+// its data stream with cancelStream. Afterwards the reply to the transfer
+// command (426 or 226) and to ABOR are read.
+func (subC *ServerSubConn) abort(ctx context.Context, cancelStream func()) error {
+	_, err := subC.controlStream.Cmd("ABOR")
+	cancelStream()
+
+	// The reply to the transfer command
+	subC.pendingReplies++
+	if err != nil {
+		return err
+	}
+	// The reply to ABOR
+	subC.pendingReplies++
+
+	return subC.readPendingReplies(ctx)
+}
+
 var errUnsupportedListLine = errors.New("Unsupported LIST line")
 
 // parseRFC3659ListLine parses the style of directory line defined in RFC 3659.
@@ -246,25 +392,8 @@ func parseRFC3659ListLine(line string) (*ftps_qftp_client.Entry, error) {
 			return nil, errUnsupportedListLine
 		}
 
-		key := field[:i]
-		value := field[i+1:]
-
-		switch key {
-		case "modify":
-			var err error
-			e.Time, err = time.Parse("20060102150405", value)
-			if err != nil {
-				return nil, err
-			}
-		case "type":
-			switch value {
-			case "dir", "cdir", "pdir":
-				e.Type = ftps_qftp_client.EntryTypeFolder
-			case "file":
-				e.Type = ftps_qftp_client.EntryTypeFile
-			}
-		case "size":
-			e.SetSize(value)
+		if err := e.SetFact(field[:i], field[i+1:]); err != nil {
+			return nil, err
 		}
 	}
 	return e, nil
@@ -380,6 +509,25 @@ var listLineParsers = []func(line string) (*ftps_qftp_client.Entry, error){
 	parseDirListLine,
 }
 
+// parseUniqueName parses the name of the file stored by STOU from a reply,
+// e.g. "FILE: name" (RFC 1123) or "Transfer complete (unique file name:name)."
+// It returns an empty string, if the reply contains no name.
+func parseUniqueName(msg string) string {
+	for _, line := range strings.Split(msg, "\n") {
+		if i := strings.Index(strings.ToUpper(line), "FILE:"); i >= 0 {
+			return strings.TrimSpace(line[i+len("FILE:"):])
+		}
+		if i := strings.Index(strings.ToLower(line), "unique file name"); i >= 0 {
+			name := strings.TrimLeft(line[i+len("unique file name"):], ": ")
+			if j := strings.LastIndex(name, ")"); j >= 0 {
+				name = name[:j]
+			}
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
 // parseListLine parses the various non-standard format returned by the LIST
 // FTP command.
 func parseListLine(line string) (*ftps_qftp_client.Entry, error) {
@@ -396,13 +544,18 @@ func parseListLine(line string) (*ftps_qftp_client.Entry, error) {
 
 // NameList issues an NLST FTP command.
 func (subC *ServerSubConn) NameList(path string) (entries []string, err error) {
-	conn, err := subC.cmdDataReceiveStreamFrom(0, "NLST %s", path)
+	return subC.NameListContext(context.Background(), path)
+}
+
+// NameListContext is like NameList but with a context.
+func (subC *ServerSubConn) NameListContext(ctx context.Context, path string) (entries []string, err error) {
+	conn, err := subC.cmdDataReceiveStreamFrom(ctx, 0, "NLST %s", path)
 	if err != nil {
 		return
 	}
 
-	r := &response{conn, subC}
-	defer subC.controlStream.ReadResponse(StatusClosingDataConnection)
+	r := subC.newResponse(ctx, conn)
+	defer r.Close()
 
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
@@ -416,13 +569,18 @@ func (subC *ServerSubConn) NameList(path string) (entries []string, err error) {
 
 // List issues a LIST FTP command.
 func (subC *ServerSubConn) List(path string) (entries []*ftps_qftp_client.Entry, err error) {
-	conn, err := subC.cmdDataReceiveStreamFrom(0, "LIST %s", path)
+	return subC.ListContext(context.Background(), path)
+}
+
+// ListContext is like List but with a context.
+func (subC *ServerSubConn) ListContext(ctx context.Context, path string) (entries []*ftps_qftp_client.Entry, err error) {
+	conn, err := subC.cmdDataReceiveStreamFrom(ctx, 0, "LIST %s", path)
 	if err != nil {
 		return
 	}
 
-	r := &response{conn, subC}
-	defer subC.controlStream.ReadResponse(StatusClosingDataConnection)
+	r := subC.newResponse(ctx, conn)
+	defer r.Close()
 
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
@@ -438,10 +596,106 @@ func (subC *ServerSubConn) List(path string) (entries []*ftps_qftp_client.Entry,
 	return
 }
 
+// ListMachine issues a MLSD FTP command, which lists the directory in the
+// machine-readable format defined in RFC 3659. If the server does not support
+// MLST, it falls back to List.
+func (subC *ServerSubConn) ListMachine(path string) (entries []*ftps_qftp_client.Entry, err error) {
+	return subC.ListMachineContext(context.Background(), path)
+}
+
+// ListMachineContext is like ListMachine but with a context.
+func (subC *ServerSubConn) ListMachineContext(ctx context.Context, path string) (entries []*ftps_qftp_client.Entry, err error) {
+	if _, mlstSupported := subC.features["MLST"]; !mlstSupported {
+		return subC.ListContext(ctx, path)
+	}
+
+	conn, err := subC.cmdDataReceiveStreamFrom(ctx, 0, "MLSD %s", path)
+	if err != nil {
+		return
+	}
+
+	r := subC.newResponse(ctx, conn)
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		entry, err := parseRFC3659ListLine(line)
+		if err != nil {
+			return nil, errors.New("Invalid MLSD line \"" + line + "\". " + err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Stat issues a MLST FTP command, which returns the facts of a single file or
+// directory as defined in RFC 3659. If the server does not support MLST, the
+// entry is searched in the List of the parent directory.
+func (subC *ServerSubConn) Stat(path string) (*ftps_qftp_client.Entry, error) {
+	return subC.StatContext(context.Background(), path)
+}
+
+// StatContext is like Stat but with a context.
+func (subC *ServerSubConn) StatContext(ctx context.Context, path string) (*ftps_qftp_client.Entry, error) {
+	if _, mlstSupported := subC.features["MLST"]; !mlstSupported {
+		return subC.statFromList(ctx, path)
+	}
+
+	_, msg, err := subC.cmdContext(ctx, StatusRequestedFileActionOK, "MLST %s", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The facts are in the only line starting with a space
+	for _, line := range strings.Split(msg, "\n") {
+		if strings.HasPrefix(line, " ") {
+			return parseRFC3659ListLine(strings.TrimPrefix(line, " "))
+		}
+	}
+	return nil, errors.New("Unsupported MLST response format")
+}
+
+// statFromList searches the entry of a file or directory in the List of its
+// parent directory.
+func (subC *ServerSubConn) statFromList(ctx context.Context, filePath string) (*ftps_qftp_client.Entry, error) {
+	dir, name := pathpkg.Split(strings.TrimSuffix(filePath, "/"))
+	if name == "" {
+		return nil, errors.New("Can not determine the entry of " + filePath + " without MLST support.")
+	}
+	if dir == "" {
+		dir = "."
+	} else if dir != "/" {
+		dir = strings.TrimSuffix(dir, "/")
+	}
+
+	entries, err := subC.ListContext(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.FileName() == name {
+			return entry, nil
+		}
+	}
+	return nil, errors.New(filePath + " not found in the listing of " + dir + ".")
+}
+
 // ChangeDir issues a CWD FTP command, which changes the current directory to
 // the specified path.
 func (subC *ServerSubConn) ChangeDir(path string) error {
-	_, _, err := subC.cmd(StatusRequestedFileActionOK, "CWD %s", path)
+	return subC.ChangeDirContext(context.Background(), path)
+}
+
+// ChangeDirContext is like ChangeDir but with a context.
+func (subC *ServerSubConn) ChangeDirContext(ctx context.Context, path string) error {
+	_, _, err := subC.cmdContext(ctx, StatusRequestedFileActionOK, "CWD %s", path)
 	return err
 }
 
@@ -449,14 +703,24 @@ func (subC *ServerSubConn) ChangeDir(path string) error {
 // directory to the parent directory.  This is similar to a call to ChangeDir
 // with a path set to "..".
 func (subC *ServerSubConn) ChangeDirToParent() error {
-	_, _, err := subC.cmd(StatusRequestedFileActionOK, "CDUP")
+	return subC.ChangeDirToParentContext(context.Background())
+}
+
+// ChangeDirToParentContext is like ChangeDirToParent but with a context.
+func (subC *ServerSubConn) ChangeDirToParentContext(ctx context.Context) error {
+	_, _, err := subC.cmdContext(ctx, StatusRequestedFileActionOK, "CDUP")
 	return err
 }
 
 // CurrentDir issues a PWD FTP command, which Returns the path of the current
 // directory.
 func (subC *ServerSubConn) CurrentDir() (string, error) {
-	_, msg, err := subC.cmd(StatusPathCreated, "PWD")
+	return subC.CurrentDirContext(context.Background())
+}
+
+// CurrentDirContext is like CurrentDir but with a context.
+func (subC *ServerSubConn) CurrentDirContext(ctx context.Context) (string, error) {
+	_, msg, err := subC.cmdContext(ctx, StatusPathCreated, "PWD")
 	if err != nil {
 		return "", err
 	}
@@ -471,25 +735,312 @@ func (subC *ServerSubConn) CurrentDir() (string, error) {
 	return msg[start+1 : end], nil
 }
 
+// FileSize issues a SIZE FTP command, which returns the size of the file in
+// bytes. SIZE is described in RFC 3659.
+func (subC *ServerSubConn) FileSize(path string) (uint64, error) {
+	return subC.FileSizeContext(context.Background(), path)
+}
+
+// FileSizeContext is like FileSize but with a context.
+func (subC *ServerSubConn) FileSizeContext(ctx context.Context, path string) (uint64, error) {
+	_, msg, err := subC.cmdContext(ctx, StatusFile, "SIZE %s", path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(msg), 10, 64)
+}
+
+// ModTime issues a MDTM FTP command, which returns the last modification time
+// of the file. MDTM is described in RFC 3659.
+func (subC *ServerSubConn) ModTime(path string) (time.Time, error) {
+	return subC.ModTimeContext(context.Background(), path)
+}
+
+// ModTimeContext is like ModTime but with a context.
+func (subC *ServerSubConn) ModTimeContext(ctx context.Context, path string) (time.Time, error) {
+	_, msg, err := subC.cmdContext(ctx, StatusFile, "MDTM %s", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// The time value may contain fractions of a second
+	return time.Parse("20060102150405", strings.TrimSpace(msg))
+}
+
+// SetModTime issues a MFMT FTP command, which sets the last modification time
+// of the file. MFMT is described in draft-somers-ftp-mfxx.
+func (subC *ServerSubConn) SetModTime(path string, t time.Time) error {
+	return subC.SetModTimeContext(context.Background(), path, t)
+}
+
+// SetModTimeContext is like SetModTime but with a context.
+func (subC *ServerSubConn) SetModTimeContext(ctx context.Context, path string, t time.Time) error {
+	_, _, err := subC.cmdContext(ctx, StatusFile, "MFMT %s %s", t.UTC().Format("20060102150405"), path)
+	return err
+}
+
+// Hash returns the hex encoded checksum of the file on the server computed
+// with the algorithm.
+// The HASH command (draft-bryan-ftpext-hash) is used, if the server lists it
+// in FEAT, the algorithm is selected with OPTS HASH. Otherwise the older
+// commands XSHA256, XSHA1, XMD5 and XCRC are used.
+// An empty algorithm is SHA-256 with HASH, without HASH the older commands
+// are tried in this order and the checksum of the first implemented one is
+// returned, its algorithm is recognizable by the length.
+// A *ftps_qftp_client.HashUnsupportedError is returned, if the server does
+// not implement the command.
+func (subC *ServerSubConn) Hash(path string, algorithm ftps_qftp_client.HashAlgorithm) (string, error) {
+	return subC.HashContext(context.Background(), path, algorithm)
+}
+
+// HashContext is like Hash but with a context.
+func (subC *ServerSubConn) HashContext(ctx context.Context, path string, algorithm ftps_qftp_client.HashAlgorithm) (string, error) {
+	feature, hashCommand := subC.features["HASH"]
+	if algorithm == "" {
+		if !hashCommand {
+			for _, algorithm := range ftps_qftp_client.HashAlgorithms {
+				checksum, err := subC.legacyHash(ctx, path, algorithm)
+				if _, unsupported := err.(*ftps_qftp_client.HashUnsupportedError); !unsupported {
+					return checksum, err
+				}
+			}
+			return "", &ftps_qftp_client.HashUnsupportedError{}
+		}
+		algorithm = ftps_qftp_client.HashSHA256
+	}
+
+	if hashCommand {
+		if supported, selected := ftps_qftp_client.HashFeature(feature, algorithm); supported {
+			// The selection of FEAT is valid until OPTS HASH
+			current := subC.hashAlgorithm
+			if current == "" && selected {
+				current = algorithm
+			}
+			if current != algorithm {
+				_, _, err := subC.cmdContext(ctx, StatusCommandOK, "OPTS HASH %s", algorithm)
+				if err != nil {
+					return "", err
+				}
+				subC.hashAlgorithm = algorithm
+			}
+
+			// e.g. 213 SHA-256 0-49 169cd22282da7f147cb491e559e9dd filename
+			_, msg, err := subC.cmdContext(ctx, StatusFile, "HASH %s", path)
+			if err != nil {
+				return "", err
+			}
+			fields := strings.Fields(msg)
+			if len(fields) < 3 {
+				return "", errors.New("Invalid HASH reply " + msg + ".")
+			}
+			return ftps_qftp_client.NormalizeHash(algorithm, fields[2]), nil
+		}
+	}
+
+	return subC.legacyHash(ctx, path, algorithm)
+}
+
+// legacyHash requests the checksum with the command of the algorithm like
+// XSHA256, which is used by servers without HASH.
+func (subC *ServerSubConn) legacyHash(ctx context.Context, path string, algorithm ftps_qftp_client.HashAlgorithm) (string, error) {
+	command := algorithm.LegacyCommand()
+	if command == "" {
+		return "", errors.New("Unknown hash algorithm " + string(algorithm) + ".")
+	}
+	code, msg, err := subC.cmdContext(ctx, -1, "%s %s", command, path)
+	if err != nil {
+		return "", err
+	}
+	switch code {
+	case StatusRequestedFileActionOK, StatusFile:
+	case StatusBadCommand, StatusNotImplemented, StatusNotImplementedParameter:
+		return "", &ftps_qftp_client.HashUnsupportedError{Algorithm: algorithm}
+	default:
+		return "", &textproto.Error{Code: code, Msg: msg}
+	}
+	fields := strings.Fields(msg)
+	if len(fields) == 0 {
+		return "", errors.New("Invalid " + command + " reply.")
+	}
+	return ftps_qftp_client.NormalizeHash(algorithm, fields[0]), nil
+}
+
+// SetTransferVerification enables the verification of complete binary
+// transfers of Retr and Stor. After the transfer the checksum of the file
+// on the server is compared with the one of the transferred data, a
+// mismatch is returned as *ftps_qftp_client.ChecksumError. The verification
+// is skipped, if the server does not support the algorithm.
+// An empty algorithm disables the verification.
+func (subC *ServerSubConn) SetTransferVerification(algorithm ftps_qftp_client.HashAlgorithm) error {
+	if algorithm != "" {
+		if _, err := algorithm.New(); err != nil {
+			return err
+		}
+	}
+	subC.verifyAlgorithm = algorithm
+	return nil
+}
+
+// SetProgressFunc sets the function, which is called with the progress of
+// the transfers of Retr, RetrFrom, Stor and StorFrom. The size of a retrieved
+// file is requested with SIZE before the transfer. MultipleTransfer also
+// reports the progress of the whole job. A nil function disables the reports.
+func (subC *ServerSubConn) SetProgressFunc(fn ftps_qftp_client.ProgressFunc) {
+	subC.progressFunc = fn
+}
+
+// newVerificationHash returns the hash for the verification of a transfer or
+// nil, if the transfer is not verified.
+func (subC *ServerSubConn) newVerificationHash(offset uint64) hash.Hash {
+	if subC.verifyAlgorithm == "" || offset != 0 || subC.transferType == ftps_qftp_client.TransferTypeASCII {
+		return nil
+	}
+	h, _ := subC.verifyAlgorithm.New()
+	return h
+}
+
+// verifyTransfer compares the checksum of the transferred data with the one
+// of the file on the server.
+func (subC *ServerSubConn) verifyTransfer(ctx context.Context, path string, h hash.Hash) error {
+	remote, err := subC.HashContext(ctx, path, subC.verifyAlgorithm)
+	if _, unsupported := err.(*ftps_qftp_client.HashUnsupportedError); unsupported {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	local := ftps_qftp_client.NormalizeHash(subC.verifyAlgorithm, hex.EncodeToString(h.Sum(nil)))
+	if local != remote {
+		return &ftps_qftp_client.ChecksumError{Path: path, Algorithm: subC.verifyAlgorithm, Local: local, Remote: remote}
+	}
+	return nil
+}
+
+// EnableCompression issues a MODE Z FTP command, so the data of the following
+// transfers and listings is compressed with deflate. The compression level of
+// the server is set with OPTS MODE Z LEVEL, if level is between 1 and 9.
+// The compression is transparent for the callers of Retr, Stor and List.
+// MODE Z is described in draft-preston-ftpext-deflate.
+func (subC *ServerSubConn) EnableCompression(level int) error {
+	return subC.EnableCompressionContext(context.Background(), level)
+}
+
+// EnableCompressionContext is like EnableCompression but with a context.
+func (subC *ServerSubConn) EnableCompressionContext(ctx context.Context, level int) error {
+	if strings.ToUpper(subC.features["MODE"]) != "Z" {
+		return errors.New("The server does not support MODE Z.")
+	}
+
+	_, _, err := subC.cmdContext(ctx, StatusCommandOK, "MODE Z")
+	if err != nil {
+		return err
+	}
+	subC.compression = true
+	subC.compressionLevel = zlib.DefaultCompression
+
+	if level >= zlib.BestSpeed && level <= zlib.BestCompression {
+		_, _, err = subC.cmdContext(ctx, StatusCommandOK, "OPTS MODE Z LEVEL %d", level)
+		if err != nil {
+			return err
+		}
+		subC.compressionLevel = level
+	}
+	return nil
+}
+
+// DisableCompression issues a MODE S FTP command to transfer the data
+// uncompressed again.
+func (subC *ServerSubConn) DisableCompression() error {
+	return subC.DisableCompressionContext(context.Background())
+}
+
+// DisableCompressionContext is like DisableCompression but with a context.
+func (subC *ServerSubConn) DisableCompressionContext(ctx context.Context) error {
+	_, _, err := subC.cmdContext(ctx, StatusCommandOK, "MODE S")
+	if err != nil {
+		return err
+	}
+	subC.compression = false
+	return nil
+}
+
+// SetTransferType issues a TYPE FTP command to set the representation type
+// of the transferred files. In ASCII mode Retr and Stor convert between the
+// local newline convention and CRLF. The type is kept after Login.
+func (subC *ServerSubConn) SetTransferType(transferType ftps_qftp_client.TransferType) error {
+	return subC.SetTransferTypeContext(context.Background(), transferType)
+}
+
+// SetTransferTypeContext is like SetTransferType but with a context.
+func (subC *ServerSubConn) SetTransferTypeContext(ctx context.Context, transferType ftps_qftp_client.TransferType) error {
+	_, _, err := subC.cmdContext(ctx, StatusCommandOK, "TYPE %c", transferType)
+	if err != nil {
+		return err
+	}
+	subC.transferType = transferType
+	return nil
+}
+
 // Retr issues a RETR FTP command to fetch the specified file from the remote
 // FTP server.
 //
-// The retrive must be finialized with FinializeRetr() to cleanup the FTP data connection.
+// The returned ReadCloser must be closed to cleanup the FTP data stream,
+// closing it before the end of the file aborts the transfer.
 func (subC *ServerSubConn) Retr(path string) (io.ReadCloser, error) {
-	return subC.RetrFrom(path, 0)
+	return subC.RetrContext(context.Background(), path)
+}
+
+// RetrContext is like Retr but with a context.
+func (subC *ServerSubConn) RetrContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	return subC.RetrFromContext(ctx, path, 0)
 }
 
 // RetrFrom issues a RETR FTP command to fetch the specified file from the remote
 // FTP server, the server will not send the offset first bytes of the file.
+// In ASCII mode offset counts the bytes of the NVT-ASCII data, see
+// ftps_qftp_client.NVTLength.
 //
-// The retrive must be finialized with FinializeRetr() to cleanup the FTP data connection.
+// The returned ReadCloser must be closed to cleanup the FTP data stream,
+// closing it before the end of the file aborts the transfer.
 func (subC *ServerSubConn) RetrFrom(path string, offset uint64) (io.ReadCloser, error) {
-	conn, err := subC.cmdDataReceiveStreamFrom(offset, "RETR %s", path)
+	return subC.RetrFromContext(context.Background(), path, offset)
+}
+
+// RetrFromContext is like RetrFrom but with a context.
+func (subC *ServerSubConn) RetrFromContext(ctx context.Context, path string, offset uint64) (io.ReadCloser, error) {
+	// The size of the file for the progress, unknown if SIZE fails
+	total := int64(-1)
+	if subC.progressFunc != nil {
+		if size, err := subC.FileSizeContext(ctx, path); err == nil {
+			total = int64(size)
+		}
+	}
+
+	conn, err := subC.cmdDataReceiveStreamFrom(ctx, offset, "RETR %s", path)
 	if err != nil {
 		return nil, err
 	}
 
-	return &response{conn, subC}, nil
+	r := subC.newResponse(ctx, conn)
+	if subC.transferType == ftps_qftp_client.TransferTypeASCII {
+		r.data = ftps_qftp_client.NewNVTDecoder(r.data)
+	}
+	if h := subC.newVerificationHash(offset); h != nil {
+		r.hash = h
+		r.path = path
+	}
+	if subC.progressFunc != nil {
+		r.progress = ftps_qftp_client.NewProgressReader(r.data, path, int64(offset), total, subC.progressFunc)
+		r.data = r.progress
+	}
+	return r, nil
+}
+
+// OpenRemoteFile opens the specified file on the remote FTP server for
+// random access with RetrFrom, see ftps_qftp_client.RemoteFile.
+// The file must be closed before the connection is used for other operations.
+func (subC *ServerSubConn) OpenRemoteFile(path string) (*ftps_qftp_client.RemoteFile, error) {
+	return ftps_qftp_client.OpenRemoteFile(subC, path)
 }
 
 // Stor issues a STOR FTP command to store a file to the remote FTP server.
@@ -497,59 +1048,355 @@ func (subC *ServerSubConn) RetrFrom(path string, offset uint64) (io.ReadCloser,
 //
 // Hint: io.Pipe() can be used if an io.Writer is required.
 func (subC *ServerSubConn) Stor(path string, r io.Reader) error {
-	return subC.StorFrom(path, r, 0)
+	return subC.StorContext(context.Background(), path, r)
+}
+
+// StorContext is like Stor but with a context.
+func (subC *ServerSubConn) StorContext(ctx context.Context, path string, r io.Reader) error {
+	return subC.StorFromContext(ctx, path, r, 0)
 }
 
 // StorFrom issues a STOR FTP command to store a file to the remote FTP server.
 // Stor creates the specified file with the content of the io.Reader, writing
 // on the server will start at the given file offset.
+// In ASCII mode offset counts the bytes of the NVT-ASCII data, see
+// ftps_qftp_client.NVTLength.
 //
 // Hint: io.Pipe() can be used if an io.Writer is required.
 func (subC *ServerSubConn) StorFrom(path string, r io.Reader, offset uint64) error {
-	stream, err := subC.cmdDataSendStreamFrom(offset, "STOR %s", path)
+	return subC.StorFromContext(context.Background(), path, r, offset)
+}
+
+// StorFromContext is like StorFrom but with a context.
+func (subC *ServerSubConn) StorFromContext(ctx context.Context, path string, r io.Reader, offset uint64) error {
+	var progress *ftps_qftp_client.ProgressReader
+	if subC.progressFunc != nil {
+		total := int64(-1)
+		if length := ftps_qftp_client.RemainingLength(r); length >= 0 {
+			total = int64(offset) + length
+		}
+		progress = ftps_qftp_client.NewProgressReader(r, path, int64(offset), total, subC.progressFunc)
+		r = progress
+	}
+
+	stream, _, err := subC.cmdDataSendStreamFrom(ctx, offset, "STOR %s", path)
 	if err != nil {
+		if progress != nil {
+			progress.Finish(err)
+		}
 		return err
 	}
 
-	_, err = io.Copy(stream, r)
-	stream.Close()
+	h := subC.newVerificationHash(offset)
+	_, err = subC.storData(ctx, stream, r, h)
+	if err == nil && h != nil {
+		err = subC.verifyTransfer(ctx, path, h)
+	}
+	if progress != nil {
+		progress.Finish(err)
+	}
+	return err
+}
+
+// Append issues a APPE FTP command to append the content of the io.Reader
+// to the specified file on the remote FTP server. The file is created, if it
+// does not exist.
+func (subC *ServerSubConn) Append(path string, r io.Reader) error {
+	return subC.AppendContext(context.Background(), path, r)
+}
+
+// AppendContext is like Append but with a context.
+func (subC *ServerSubConn) AppendContext(ctx context.Context, path string, r io.Reader) error {
+	stream, _, err := subC.cmdDataSendStreamFrom(ctx, 0, "APPE %s", path)
+	if err != nil {
+		return err
+	}
+
+	_, err = subC.storData(ctx, stream, r, nil)
+	return err
+}
+
+// StorUnique issues a STOU FTP command to store the content of the io.Reader
+// in a new file with a unique name chosen by the server. It returns the name
+// of the file, which is parsed from the replies of the server.
+func (subC *ServerSubConn) StorUnique(r io.Reader) (string, error) {
+	return subC.StorUniqueContext(context.Background(), r)
+}
+
+// StorUniqueContext is like StorUnique but with a context.
+func (subC *ServerSubConn) StorUniqueContext(ctx context.Context, r io.Reader) (string, error) {
+	stream, msg, err := subC.cmdDataSendStreamFrom(ctx, 0, "STOU")
+	if err != nil {
+		return "", err
+	}
+
+	h := subC.newVerificationHash(0)
+	finalMsg, err := subC.storData(ctx, stream, r, h)
+	if err != nil {
+		return "", err
+	}
+
+	name := parseUniqueName(msg)
+	if name == "" {
+		name = parseUniqueName(finalMsg)
+	}
+	if name == "" {
+		return "", errors.New("The server did not report the name of the stored file.")
+	}
+	if h != nil {
+		err = subC.verifyTransfer(ctx, name, h)
+	}
+	return name, err
+}
+
+// ResumeRetr downloads the specified file from the remote FTP server to the
+// local file. If the local file is shorter than the file on the server, only
+// the missing part is retrieved and appended. Otherwise or if the server does
+// not accept REST, the whole file is retrieved. Nothing is transferred, if
+// both files have the same size.
+// In ASCII mode the sizes are not comparable and the whole file is retrieved.
+func (subC *ServerSubConn) ResumeRetr(remote string, localFile string) error {
+	return subC.ResumeRetrContext(context.Background(), remote, localFile)
+}
+
+// ResumeRetrContext is like ResumeRetr but with a context.
+func (subC *ServerSubConn) ResumeRetrContext(ctx context.Context, remote string, localFile string) error {
+	// The local file is only created, when the server sends the file
+	info, err := os.Stat(localFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var offset uint64
+	if info != nil && subC.transferType != ftps_qftp_client.TransferTypeASCII {
+		remoteSize, err := subC.remoteSize(ctx, remote)
+		localSize := uint64(info.Size())
+		if err == nil && localSize == remoteSize {
+			return nil
+		} else if err == nil && localSize < remoteSize {
+			offset = localSize
+		}
+	}
+
+	r, err := subC.RetrFromContext(ctx, remote, offset)
+	if _, ok := err.(*restartError); ok {
+		offset = 0
+		r, err = subC.RetrFromContext(ctx, remote, offset)
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(localFile, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	defer file.Close()
+	err = file.Truncate(int64(offset))
+	if err == nil {
+		_, err = file.Seek(int64(offset), io.SeekStart)
+	}
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
 	if err != nil {
+		r.Close()
 		return err
 	}
+	return r.Close()
+}
+
+// ResumeStor uploads the local file to the specified file on the remote FTP
+// server. If the file on the server is shorter than the local file, only the
+// missing part is stored. Otherwise or if the server does not accept REST,
+// the whole file is stored. Nothing is transferred, if both files have the
+// same size.
+// In ASCII mode the sizes are not comparable and the whole file is stored.
+func (subC *ServerSubConn) ResumeStor(localFile string, remote string) error {
+	return subC.ResumeStorContext(context.Background(), localFile, remote)
+}
 
-	_, _, err = subC.controlStream.ReadResponse(StatusClosingDataConnection)
+// ResumeStorContext is like ResumeStor but with a context.
+func (subC *ServerSubConn) ResumeStorContext(ctx context.Context, localFile string, remote string) error {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset uint64
+	if subC.transferType != ftps_qftp_client.TransferTypeASCII {
+		remoteSize, err := subC.remoteSize(ctx, remote)
+		localSize := uint64(info.Size())
+		if err == nil && localSize == remoteSize {
+			return nil
+		} else if err == nil && remoteSize < localSize {
+			offset = remoteSize
+		}
+	}
+
+	_, err = file.Seek(int64(offset), io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = subC.StorFromContext(ctx, remote, file, offset)
+	if _, ok := err.(*restartError); ok {
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		err = subC.StorFromContext(ctx, remote, file, 0)
+	}
 	return err
 }
 
+// remoteSize returns the size of the file on the server with SIZE or, if
+// SIZE fails, with MLST or LIST.
+func (subC *ServerSubConn) remoteSize(ctx context.Context, path string) (uint64, error) {
+	size, err := subC.FileSizeContext(ctx, path)
+	if err == nil {
+		return size, nil
+	}
+	entry, statErr := subC.StatContext(ctx, path)
+	if statErr != nil {
+		return 0, err
+	}
+	return entry.Size, nil
+}
+
+// storData sends the content of the io.Reader over the data stream of a
+// STOR, APPE or STOU command and returns the message of the final reply.
+// The sent data is written to h, if it is not nil.
+func (subC *ServerSubConn) storData(ctx context.Context, stream quic.SendStream, r io.Reader, h hash.Hash) (string, error) {
+	stop := watchContext(ctx, func() {
+		stream.CancelWrite(dataStreamCanceled)
+	})
+	if h != nil {
+		r = io.TeeReader(r, h)
+	}
+	if subC.transferType == ftps_qftp_client.TransferTypeASCII {
+		r = ftps_qftp_client.NewNVTEncoder(r)
+	}
+	var w io.Writer = stream
+	var zw *zlib.Writer
+	if subC.compression {
+		// the level was checked by EnableCompression
+		zw, _ = zlib.NewWriterLevel(stream, subC.compressionLevel)
+		w = zw
+	}
+	_, err := io.Copy(w, r)
+	if err == nil && zw != nil {
+		// write the end of the compressed stream
+		err = zw.Close()
+	}
+	stop()
+	if err != nil {
+		subC.abort(ctx, func() {
+			stream.CancelWrite(dataStreamCanceled)
+		})
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+	stream.Close()
+
+	_, msg, err := subC.readResponse(ctx, StatusClosingDataConnection)
+	return msg, err
+}
+
 // Rename renames a file on the remote FTP server.
 func (subC *ServerSubConn) Rename(from, to string) error {
-	_, _, err := subC.cmd(StatusRequestFilePending, "RNFR %s", from)
+	return subC.RenameContext(context.Background(), from, to)
+}
+
+// RenameContext is like Rename but with a context.
+func (subC *ServerSubConn) RenameContext(ctx context.Context, from, to string) error {
+	_, _, err := subC.cmdContext(ctx, StatusRequestFilePending, "RNFR %s", from)
 	if err != nil {
 		return err
 	}
 
-	_, _, err = subC.cmd(StatusRequestedFileActionOK, "RNTO %s", to)
+	_, _, err = subC.cmdContext(ctx, StatusRequestedFileActionOK, "RNTO %s", to)
 	return err
 }
 
 // Delete issues a DELE FTP command to delete the specified file from the
 // remote FTP server.
 func (subC *ServerSubConn) Delete(path string) error {
-	_, _, err := subC.cmd(StatusRequestedFileActionOK, "DELE %s", path)
+	return subC.DeleteContext(context.Background(), path)
+}
+
+// DeleteContext is like Delete but with a context.
+func (subC *ServerSubConn) DeleteContext(ctx context.Context, path string) error {
+	_, _, err := subC.cmdContext(ctx, StatusRequestedFileActionOK, "DELE %s", path)
 	return err
 }
 
 // MakeDir issues a MKD FTP command to create the specified directory on the
 // remote FTP server.
 func (subC *ServerSubConn) MakeDir(path string) error {
-	_, _, err := subC.cmd(StatusPathCreated, "MKD %s", path)
+	return subC.MakeDirContext(context.Background(), path)
+}
+
+// MakeDirContext is like MakeDir but with a context.
+func (subC *ServerSubConn) MakeDirContext(ctx context.Context, path string) error {
+	_, _, err := subC.cmdContext(ctx, StatusPathCreated, "MKD %s", path)
+	return err
+}
+
+// MakeDirAll creates the specified directory on the remote FTP server
+// together with all missing parent directories. Existing directories, which
+// are reported with 550 or 521 replies to MKD, are no error.
+func (subC *ServerSubConn) MakeDirAll(path string) error {
+	return subC.MakeDirAllContext(context.Background(), path)
+}
+
+// MakeDirAllContext is like MakeDirAll but with a context.
+func (subC *ServerSubConn) MakeDirAllContext(ctx context.Context, path string) error {
+	dir := ""
+	if strings.HasPrefix(path, "/") {
+		dir = "/"
+	}
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		dir = pathpkg.Join(dir, name)
+		err := subC.makeDirIfMissing(ctx, dir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeDirIfMissing issues a MKD FTP command and accepts the replies to an
+// existing directory.
+func (subC *ServerSubConn) makeDirIfMissing(ctx context.Context, path string) error {
+	err := subC.MakeDirContext(ctx, path)
+	if protoErr, ok := err.(*textproto.Error); ok {
+		if protoErr.Code == StatusFileUnavailable || protoErr.Code == StatusDirectoryExists {
+			return nil
+		}
+	}
 	return err
 }
 
 // RemoveDir issues a RMD FTP command to remove the specified directory from
 // the remote FTP server.
 func (subC *ServerSubConn) RemoveDir(path string) error {
-	_, _, err := subC.cmd(StatusRequestedFileActionOK, "RMD %s", path)
+	return subC.RemoveDirContext(context.Background(), path)
+}
+
+// RemoveDirContext is like RemoveDir but with a context.
+func (subC *ServerSubConn) RemoveDirContext(ctx context.Context, path string) error {
+	_, _, err := subC.cmdContext(ctx, StatusRequestedFileActionOK, "RMD %s", path)
 	return err
 }
 
@@ -557,31 +1404,67 @@ func (subC *ServerSubConn) RemoveDir(path string) error {
 // NOOP has no effects and is usually used to prevent the remote FTP server to
 // close the otherwise idle connection.
 func (subC *ServerSubConn) NoOp() error {
-	_, _, err := subC.cmd(StatusCommandOK, "NOOP")
+	return subC.NoOpContext(context.Background())
+}
+
+// NoOpContext is like NoOp but with a context.
+func (subC *ServerSubConn) NoOpContext(ctx context.Context) error {
+	_, _, err := subC.cmdContext(ctx, StatusCommandOK, "NOOP")
 	return err
 }
 
 // cmd is a helper function to execute a command and check for the expected FTP
 // return code
 func (subC *ServerSubConn) cmd(expected int, format string, args ...interface{}) (int, string, error) {
-	_, err := subC.controlStream.Cmd(format, args...)
+	return subC.cmdContext(context.Background(), expected, format, args...)
+}
+
+// cmdContext is like cmd but interrupts the command when ctx is done.
+func (subC *ServerSubConn) cmdContext(ctx context.Context, expected int, format string, args ...interface{}) (int, string, error) {
+	err := subC.sendCmd(ctx, format, args...)
 	if err != nil {
 		return 0, "", err
 	}
 
-	return subC.controlStream.ReadResponse(expected)
+	return subC.readResponse(ctx, expected)
+}
+
+// sendCmd sends a command on the control stream after the pending replies
+// of interrupted commands were read. It is not sent, if ctx is done.
+func (subC *ServerSubConn) sendCmd(ctx context.Context, format string, args ...interface{}) error {
+	err := subC.readPendingReplies(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	// The write is not interrupted, see withContext
+	_, err = subC.controlStream.Cmd(format, args...)
+	return err
 }
 
 // Logout issues a REIN FTP command to logout the current user.
 func (subC *ServerSubConn) Logout() error {
-	_, _, err := subC.cmd(StatusReady, "REIN")
+	return subC.LogoutContext(context.Background())
+}
+
+// LogoutContext is like Logout but with a context.
+func (subC *ServerSubConn) LogoutContext(ctx context.Context) error {
+	_, _, err := subC.cmdContext(ctx, StatusReady, "REIN")
 	return err
 }
 
 // Quit issues a QUIT FTP command to properly close the connection from the
 // remote FTP server.
 func (subC *ServerSubConn) Quit() error {
-	_, _, err := subC.cmd(StatusClosing, "QUIT")
+	return subC.QuitContext(context.Background())
+}
+
+// QuitContext is like Quit but with a context.
+func (subC *ServerSubConn) QuitContext(ctx context.Context) error {
+	_, _, err := subC.cmdContext(ctx, StatusClosing, "QUIT")
 	if err != nil {
 		return err
 	}
@@ -590,13 +1473,41 @@ func (subC *ServerSubConn) Quit() error {
 
 // Read implements the io.Reader interface on a FTP data connection.
 func (r *response) Read(buf []byte) (int, error) {
-	return r.conn.Read(buf)
+	n, err := r.data.Read(buf)
+	if r.hash != nil {
+		r.hash.Write(buf[:n])
+	}
+	if err == io.EOF {
+		r.eof = true
+	} else if err != nil && r.ctx.Err() != nil {
+		err = r.ctx.Err()
+	}
+	return n, err
 }
 
 // Close implements the io.Closer interface on a FTP data stream.
+// If the transfer is not complete, it is aborted.
 func (r *response) Close() error {
+	err := r.close()
+	if r.progress != nil {
+		r.progress.Finish(err)
+	}
+	return err
+}
+
+// close closes the data connection and reads the reply of the transfer.
+func (r *response) close() error {
+	r.stop()
+	if !r.eof {
+		return r.c.abort(r.ctx, func() {
+			r.conn.CancelRead(dataStreamCanceled)
+		})
+	}
 	// data stream is unidirectional must not be closed, just the
 	// the response on the control stream need to be read
-	_, _, err := r.c.controlStream.ReadResponse(StatusClosingDataConnection)
-	return err
+	_, _, err := r.c.readResponse(r.ctx, StatusClosingDataConnection)
+	if err != nil || r.hash == nil {
+		return err
+	}
+	return r.c.verifyTransfer(r.ctx, r.path, r.hash)
 }
@@ -0,0 +1,776 @@
+// Contains the functions for parallel transfer with multiple QUIC sub connections.
+// Store and receive of files is possible.
+
+package ftpq
+
+import (
+	"context"
+	"errors"
+	"github.com/attenberger/ftps_qftp-client"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type TransferDirction int8
+
+const (
+	Retrieve = TransferDirction(1)
+	Store    = TransferDirction(2)
+)
+
+// Task to inform a go routine which transfer should be performed
+type TransferTask struct {
+	localpath  string
+	remotepath string
+	direction  TransferDirction
+	resume     bool // continue an interrupted transfer, see ResumeRetr and ResumeStor
+	finished   bool
+}
+
+// Creates a new TransferTask
+func NewTransferTask(direction TransferDirction, localpath string, remotepath string) TransferTask {
+	return TransferTask{localpath: localpath, remotepath: remotepath, direction: direction, finished: false}
+}
+
+// Creates a new TransferTask, which continues an interrupted transfer of the
+// file. Just the missing part of the file is transferred.
+func NewResumeTransferTask(direction TransferDirction, localpath string, remotepath string) TransferTask {
+	return TransferTask{localpath: localpath, remotepath: remotepath, direction: direction, resume: true, finished: false}
+}
+
+// MultipleTransfer issues STOR and RETR FTP commands in parallel sub
+// connections to transfer multiple files. nrParallel is the number of sub
+// connections including subC.
+// The progress of the transfers is reported with the progress of the whole
+// job, see SetProgressFunc.
+func (subC *ServerSubConn) MultipleTransfer(tasks []TransferTask, nrParallel int) error {
+	currentdirctory, err := subC.CurrentDir()
+	if err != nil {
+		return err
+	}
+
+	// Not more connections than files to store or negative
+	if len(tasks) < nrParallel || nrParallel < 0 {
+		nrParallel = len(tasks)
+	}
+
+	// The progress of the transfers is reported with the progress of the job
+	progress := subC.progressFunc
+	if progress != nil {
+		defer subC.SetProgressFunc(progress)
+		progress = ftps_qftp_client.NewJobProgressFunc(len(tasks), progress)
+		subC.progressFunc = progress
+	}
+
+	// Write all tasks to the channel including the finishing message
+	taskChannel := make(chan TransferTask, len(tasks)+nrParallel)
+	returnChannel := make(chan error, len(tasks))
+	for _, task := range tasks {
+		task.finished = false
+		taskChannel <- task
+	}
+	for i := 0; i < nrParallel; i++ {
+		taskChannel <- TransferTask{finished: true}
+	}
+
+	// Start goroutines for parallel sub connections and provide the channels for communication
+	for i := 0; i < nrParallel-1; i++ {
+		go subC.parallelTransfer(currentdirctory, taskChannel, returnChannel, progress)
+	}
+	// The main sub connection is also used for parallel transfer
+	for {
+		task := <-taskChannel
+		if task.finished {
+			break
+		}
+		returnChannel <- subC.runTask(task)
+	}
+
+	var transferErrors []error
+	// Wait for replais of the transfers in the goroutines
+	for normalReplay, goRoutineResetReply := 0, 0; normalReplay < len(tasks) && goRoutineResetReply < nrParallel; normalReplay++ {
+		replay := <-returnChannel
+		if replay != nil {
+			transferErrors = append(transferErrors, replay)
+			if strings.HasPrefix("Go routine reset.", replay.Error()) {
+				goRoutineResetReply++
+			}
+		}
+	}
+	if len(transferErrors) == 0 {
+		return nil
+	} else {
+		return &ftps_qftp_client.MultipleErrors{Errors: transferErrors}
+	}
+}
+
+// Runs a parallel transfer.
+// In the taskChannel it gets the TransferTask to perform.
+// In the returnChannel it returns occured error or nil for success
+func (subC *ServerSubConn) parallelTransfer(dirctory string, taskChannel chan TransferTask, returnChannel chan error, progress ftps_qftp_client.ProgressFunc) {
+	conn, err := subC.openParallelSubConn(context.Background(), dirctory)
+	if err != nil {
+		returnChannel <- errors.New("Go routine reset. " + err.Error())
+		return
+	}
+	defer conn.Quit()
+	conn.progressFunc = progress
+
+	// run tasks
+	for {
+		task := <-taskChannel
+		if task.finished {
+			return
+		}
+		returnChannel <- conn.runTask(task)
+	}
+}
+
+// runTask performs the transfer of a TransferTask.
+func (subC *ServerSubConn) runTask(task TransferTask) error {
+	switch task.direction {
+	case Store:
+		return subC.parallelStorTask(task)
+	case Retrieve:
+		return subC.parallelRetrTask(task)
+	}
+	return errors.New("Unknown direction for transfer.")
+}
+
+// Stores a file at the server within a parallel transfer.
+func (subC *ServerSubConn) parallelStorTask(task TransferTask) error {
+	if task.resume {
+		err := subC.ResumeStor(task.localpath, task.remotepath)
+		if _, ok := err.(*ftps_qftp_client.ChecksumError); ok {
+			return err
+		} else if err != nil {
+			return errors.New("Error while writing file " + task.localpath + " to server. " + err.Error())
+		}
+		return nil
+	}
+
+	file, err := os.Open(task.localpath)
+	defer file.Close()
+	if err != nil {
+		return errors.New("Error while opening the local file " + task.localpath + ". " + err.Error())
+	}
+
+	err = subC.Stor(task.remotepath, file)
+	if _, ok := err.(*ftps_qftp_client.ChecksumError); ok {
+		return err
+	} else if err != nil {
+		return errors.New("Error while writing file " + task.localpath + " to server. " + err.Error())
+	}
+	return nil
+}
+
+// Receives a file at the server within a parallel transfer.
+func (subC *ServerSubConn) parallelRetrTask(task TransferTask) error {
+	if task.resume {
+		return subC.ResumeRetr(task.remotepath, task.localpath)
+	}
+
+	// Check if file already exists at client
+	if _, err := os.Stat(task.localpath); os.IsExist(err) {
+		return errors.New("File with this name already exists in local folder.")
+	}
+
+	// Create and open the file
+	file, err := os.Create(task.localpath)
+	if err != nil {
+		return errors.New("Error while creating the local file. " + err.Error())
+	}
+	defer file.Close()
+
+	// Retrieve the file and write it to the filesystem
+	reader, err := subC.Retr(task.remotepath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		errortext := "Error while writing file to local file. " + err.Error()
+		err = reader.Close()
+		if err != nil {
+			errortext = errortext + " Error while closing reader from server. " + err.Error()
+		}
+		return errors.New(errortext)
+	}
+
+	// Finalize retrieve of the file
+	err = reader.Close()
+	if _, ok := err.(*ftps_qftp_client.ChecksumError); ok {
+		return err
+	} else if err != nil {
+		return errors.New(" Error while closing reader from server. " + err.Error())
+	}
+	return nil
+}
+
+// DownloadDir retrieves the directory tree remoteDir from the remote FTP
+// server and stores it in localDir. The tree is walked with
+// ftps_qftp_client.Walk and the directories are created locally, the files
+// are retrieved with MultipleTransfer on opts.Parallel sub connections.
+// Links on the server are skipped, because the type of their targets is unknown.
+func (subC *ServerSubConn) DownloadDir(remoteDir string, localDir string, opts ftps_qftp_client.DirTransferOptions) error {
+	tasks, err := subC.downloadTasks(remoteDir, localDir, opts.Resume)
+	if err != nil || len(tasks) == 0 {
+		return err
+	}
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	return subC.MultipleTransfer(tasks, opts.Parallel)
+}
+
+// downloadTasks walks the directory tree remoteDir, creates the directories
+// in localDir and returns the tasks to retrieve the files.
+func (subC *ServerSubConn) downloadTasks(remoteDir string, localDir string, resume bool) ([]TransferTask, error) {
+	var tasks []TransferTask
+	localDirs := make(map[string]string) // local directories by their remote paths
+	err := ftps_qftp_client.WalkContext(context.Background(), subC, remoteDir, ftps_qftp_client.WalkOptions{}, func(remotepath string, entry *ftps_qftp_client.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		localpath := localDir
+		if remotepath != remoteDir {
+			localpath = filepath.Join(localDirs[pathpkg.Dir(remotepath)], entry.FileName())
+		} else if entry.Type == ftps_qftp_client.EntryTypeFile {
+			return errors.New(remoteDir + " is not a directory.")
+		}
+
+		switch entry.Type {
+		case ftps_qftp_client.EntryTypeFolder:
+			err = os.MkdirAll(localpath, 0755)
+			if err != nil {
+				return errors.New("Error while creating the local directory. " + err.Error())
+			}
+			localDirs[pathpkg.Clean(remotepath)] = localpath
+		case ftps_qftp_client.EntryTypeFile:
+			if resume {
+				tasks = append(tasks, NewResumeTransferTask(Retrieve, localpath, remotepath))
+			} else {
+				tasks = append(tasks, NewTransferTask(Retrieve, localpath, remotepath))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// UploadDir stores the local directory tree localDir in remoteDir on the
+// remote FTP server. The directories are created with MakeDirAll, the files
+// are stored with MultipleTransfer on opts.Parallel sub connections.
+// Symbolic links are skipped or followed according to opts.Symlinks.
+func (subC *ServerSubConn) UploadDir(localDir string, remoteDir string, opts ftps_qftp_client.DirTransferOptions) error {
+	err := subC.MakeDirAll(remoteDir)
+	if err != nil {
+		return err
+	}
+	parents := make(map[string]bool)
+	tasks, err := subC.uploadTasks(localDir, remoteDir, opts, parents)
+	if err != nil || len(tasks) == 0 {
+		return err
+	}
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	return subC.MultipleTransfer(tasks, opts.Parallel)
+}
+
+// uploadTasks reads the local directory tree localDir recursively, creates
+// the directories in remoteDir and returns the tasks to store the files.
+// parents contains the real paths of the directories above localDir to detect
+// loops of followed links.
+func (subC *ServerSubConn) uploadTasks(localDir string, remoteDir string, opts ftps_qftp_client.DirTransferOptions, parents map[string]bool) ([]TransferTask, error) {
+	realDir, err := filepath.EvalSymlinks(localDir)
+	if err != nil {
+		return nil, err
+	}
+	if parents[realDir] {
+		// a link to a parent directory
+		return nil, nil
+	}
+	parents[realDir] = true
+	defer delete(parents, realDir)
+
+	infos, err := ioutil.ReadDir(localDir)
+	if err != nil {
+		return nil, errors.New("Error while reading the local directory. " + err.Error())
+	}
+
+	var tasks []TransferTask
+	for _, info := range infos {
+		localpath := filepath.Join(localDir, info.Name())
+		remotepath := pathpkg.Join(remoteDir, info.Name())
+		if info.Mode()&os.ModeSymlink != 0 {
+			if opts.Symlinks != ftps_qftp_client.FollowSymlinks {
+				continue
+			}
+			info, err = os.Stat(localpath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if info.IsDir() {
+			err = subC.makeDirIfMissing(context.Background(), remotepath)
+			if err != nil {
+				return nil, err
+			}
+			subtasks, err := subC.uploadTasks(localpath, remotepath, opts, parents)
+			if err != nil {
+				return nil, err
+			}
+			tasks = append(tasks, subtasks...)
+		} else if info.Mode().IsRegular() {
+			if opts.Resume {
+				tasks = append(tasks, NewResumeTransferTask(Store, localpath, remotepath))
+			} else {
+				tasks = append(tasks, NewTransferTask(Store, localpath, remotepath))
+			}
+		}
+	}
+	return tasks, nil
+}
+
+// openParallelSubConn opens an additional sub connection to the server with
+// the settings of subC, logs in and changes to the directory.
+func (subC *ServerSubConn) openParallelSubConn(ctx context.Context, dirctory string) (*ServerSubConn, error) {
+	conn, _, err := subC.serverConnection.GetNewSubConn()
+	if err != nil {
+		return nil, err
+	}
+	conn.transferType = subC.transferType
+	conn.verifyAlgorithm = subC.verifyAlgorithm
+	// Login in
+	err = conn.LoginContext(ctx, subC.username, subC.password)
+	if err != nil {
+		conn.Quit()
+		return nil, err
+	}
+	if subC.compression {
+		err = conn.EnableCompressionContext(ctx, subC.compressionLevel)
+		if err != nil {
+			conn.Quit()
+			return nil, err
+		}
+	}
+	// Change to directory of the main sub connection
+	err = conn.ChangeDirContext(ctx, dirctory)
+	if err != nil {
+		conn.Quit()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ParallelRetr issues RETR FTP commands on several sub connections to fetch
+// the specified file from the remote FTP server in segments. The file is
+// split in byte ranges, each sub connection retrieves one range with RetrFrom
+// and writes it to dst at its offset. The first segment is retrieved with
+// subC, the others with additional sub connections using the settings of subC.
+//
+// The size of the file is determined with SIZE, MLST or LIST. Segments are
+// just possible in binary mode.
+func (subC *ServerSubConn) ParallelRetr(path string, dst io.WriterAt, segments int) error {
+	return subC.ParallelRetrContext(context.Background(), path, dst, segments)
+}
+
+// ParallelRetrContext is like ParallelRetr but with a context.
+func (subC *ServerSubConn) ParallelRetrContext(ctx context.Context, path string, dst io.WriterAt, segments int) error {
+	if subC.transferType != ftps_qftp_client.TransferTypeBinary {
+		return errors.New("Segmented transfers are just possible in binary mode.")
+	}
+	size, err := subC.remoteSize(ctx, path)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+	// At least one byte per segment
+	if segments < 1 {
+		segments = 1
+	} else if uint64(segments) > size {
+		segments = int(size)
+	}
+	currentdirctory, err := subC.CurrentDirContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The other segments are canceled, when a segment fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	returnChannel := make(chan error, segments)
+	for i := 0; i < segments; i++ {
+		start := size * uint64(i) / uint64(segments)
+		end := size * uint64(i+1) / uint64(segments)
+		go func(i int) {
+			// The main sub connection is also used for a segment
+			conn := subC
+			if i > 0 {
+				var err error
+				conn, err = subC.openParallelSubConn(ctx, currentdirctory)
+				if err != nil {
+					returnChannel <- err
+					cancel()
+					return
+				}
+				defer conn.Quit()
+			}
+			err := conn.retrSegment(ctx, path, dst, start, end, end == size)
+			returnChannel <- err
+			if err != nil {
+				cancel()
+			}
+		}(i)
+	}
+
+	// The first error is the cause, the others may be caused by the cancellation
+	var firstErr error
+	for i := 0; i < segments; i++ {
+		if err := <-returnChannel; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// retrSegment retrieves the bytes from start to end of the file and writes
+// them to dst. The transfer of a segment, which does not end at the end of
+// the file, is aborted after its last byte.
+func (subC *ServerSubConn) retrSegment(ctx context.Context, path string, dst io.WriterAt, start uint64, end uint64, last bool) error {
+	r, err := subC.RetrFromContext(ctx, path, start)
+	if err != nil {
+		return err
+	}
+
+	w := io.NewOffsetWriter(dst, int64(start))
+	var n int64
+	if last {
+		n, err = io.Copy(w, r)
+	} else {
+		n, err = io.CopyN(w, r, int64(end-start))
+	}
+	if err == nil && n < int64(end-start) {
+		err = errors.New("The file " + path + " on the server is shorter than expected.")
+	} else if err == io.EOF {
+		err = errors.New("The file " + path + " on the server is shorter than expected.")
+	}
+	if err != nil {
+		r.Close()
+		return err
+	}
+	return r.Close()
+}
+
+// ParallelStor issues STOR FTP commands on several sub connections to store the
+// content of src with the given size in the specified file on the remote FTP
+// server. The content is split in byte ranges, each sub connection stores one
+// range with StorFrom at its offset. The first segment is stored with subC,
+// the others with additional sub connections using the settings of subC.
+//
+// Segments require REST STREAM (RFC 3659) and binary mode, otherwise or if the
+// server rejects an offset beyond the end of the file, the whole content is
+// stored with subC.
+func (subC *ServerSubConn) ParallelStor(src io.ReaderAt, size int64, remote string, segments int) error {
+	return subC.ParallelStorContext(context.Background(), src, size, remote, segments)
+}
+
+// ParallelStorContext is like ParallelStor but with a context.
+func (subC *ServerSubConn) ParallelStorContext(ctx context.Context, src io.ReaderAt, size int64, remote string, segments int) error {
+	// At least one byte per segment
+	if int64(segments) > size {
+		segments = int(size)
+	}
+	if segments <= 1 || subC.features["REST"] != "STREAM" || subC.transferType != ftps_qftp_client.TransferTypeBinary {
+		return subC.StorContext(ctx, remote, io.NewSectionReader(src, 0, size))
+	}
+	currentdirctory, err := subC.CurrentDirContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The file is created before the other segments are stored, STOR
+	// truncates an existing file
+	segmentEnd := size / int64(segments)
+	conn, _, err := subC.cmdDataSendStreamFrom(ctx, 0, "STOR %s", remote)
+	if err != nil {
+		return err
+	}
+
+	// The other segments are canceled, when a segment fails
+	segmentCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	returnChannel := make(chan error, segments)
+	go func() {
+		_, err := subC.storData(segmentCtx, conn, io.NewSectionReader(src, 0, segmentEnd), nil)
+		returnChannel <- err
+		if err != nil {
+			cancel()
+		}
+	}()
+	for i := 1; i < segments; i++ {
+		start := size * int64(i) / int64(segments)
+		end := size * int64(i+1) / int64(segments)
+		go func() {
+			parallelConn, err := subC.openParallelSubConn(segmentCtx, currentdirctory)
+			if err == nil {
+				defer parallelConn.Quit()
+				err = parallelConn.StorFromContext(segmentCtx, remote, io.NewSectionReader(src, start, end-start), uint64(start))
+			}
+			returnChannel <- err
+			if err != nil {
+				cancel()
+			}
+		}()
+	}
+
+	// The first error is the cause, the others may be caused by the cancellation
+	var firstErr error
+	for i := 0; i < segments; i++ {
+		if err := <-returnChannel; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if _, ok := firstErr.(*restartError); ok {
+		return subC.StorContext(ctx, remote, io.NewSectionReader(src, 0, size))
+	} else if protoErr, ok := firstErr.(*textproto.Error); ok && protoErr.Code == StatusInvalidRestart {
+		return subC.StorContext(ctx, remote, io.NewSectionReader(src, 0, size))
+	} else if firstErr != nil {
+		return firstErr
+	}
+
+	// The segments are not verified, but the whole file
+	h := subC.newVerificationHash(0)
+	if h == nil {
+		return nil
+	}
+	_, err = io.Copy(h, io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return err
+	}
+	return subC.verifyTransfer(ctx, remote, h)
+}
+
+// RemoveAll removes the specified file or directory tree from the remote FTP
+// server. The tree is listed with ListMachine, the files and links are
+// deleted with DELE and the directories with RMD after their content.
+// The paths, which could not be removed, are returned in a
+// *ftps_qftp_client.RemoveAllError.
+func (subC *ServerSubConn) RemoveAll(path string) error {
+	return subC.RemoveAllParallelContext(context.Background(), path, 1)
+}
+
+// RemoveAllContext is like RemoveAll but with a context.
+func (subC *ServerSubConn) RemoveAllContext(ctx context.Context, path string) error {
+	return subC.RemoveAllParallelContext(ctx, path, 1)
+}
+
+// RemoveAllParallel is like RemoveAll, but deletes the files concurrently on
+// nrParallel sub connections including subC.
+func (subC *ServerSubConn) RemoveAllParallel(path string, nrParallel int) error {
+	return subC.RemoveAllParallelContext(context.Background(), path, nrParallel)
+}
+
+// RemoveAllParallelContext is like RemoveAllParallel but with a context.
+func (subC *ServerSubConn) RemoveAllParallelContext(ctx context.Context, path string, nrParallel int) error {
+	// A file or link is deleted directly
+	if subC.DeleteContext(ctx, path) == nil {
+		return nil
+	}
+	files, dirs, err := subC.listTree(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	removeErr := &ftps_qftp_client.RemoveAllError{}
+	subC.deleteFiles(ctx, files, nrParallel, removeErr)
+	// The directories are listed after their content
+	for _, dir := range dirs {
+		err = subC.RemoveDirContext(ctx, dir)
+		if err != nil {
+			removeErr.Add(dir, err)
+		}
+	}
+	if len(removeErr.Paths) > 0 {
+		return removeErr
+	}
+	return nil
+}
+
+// listTree walks the tree root. It returns the files and links and the
+// directories, which are listed after their subdirectories.
+func (subC *ServerSubConn) listTree(ctx context.Context, root string) (files []string, dirs []string, err error) {
+	err = ftps_qftp_client.WalkContext(ctx, subC, root, ftps_qftp_client.WalkOptions{}, func(path string, entry *ftps_qftp_client.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type == ftps_qftp_client.EntryTypeFolder {
+			dirs = append(dirs, path)
+		} else {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// The subdirectories are walked after their parents
+	for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+	}
+	return files, dirs, nil
+}
+
+// deleteFiles deletes the files on nrParallel sub connections including subC and
+// adds the failed deletions to removeErr.
+func (subC *ServerSubConn) deleteFiles(ctx context.Context, files []string, nrParallel int, removeErr *ftps_qftp_client.RemoveAllError) {
+	currentdirctory := ""
+	if nrParallel > 1 && len(files) > 1 {
+		var err error
+		currentdirctory, err = subC.CurrentDirContext(ctx)
+		if err != nil {
+			// The files are deleted with subC
+			nrParallel = 1
+		}
+	}
+
+	fileChannel := make(chan string, len(files))
+	for _, file := range files {
+		fileChannel <- file
+	}
+	close(fileChannel)
+
+	var lock sync.Mutex
+	deleteFromChannel := func(conn *ServerSubConn) {
+		for file := range fileChannel {
+			err := conn.DeleteContext(ctx, file)
+			if err != nil {
+				lock.Lock()
+				removeErr.Add(file, err)
+				lock.Unlock()
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i < nrParallel && i < len(files); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := subC.openParallelSubConn(ctx, currentdirctory)
+			if err != nil {
+				// The files are deleted by the other sub connections
+				return
+			}
+			defer conn.Quit()
+			deleteFromChannel(conn)
+		}()
+	}
+	// The main sub connection is also used
+	deleteFromChannel(subC)
+	wg.Wait()
+}
+
+// Sync synchronizes the local tree localDir with the tree remoteDir on the
+// remote FTP server according to opts, see ftps_qftp_client.PlanSync.
+// The directories are created first, then the files are transferred with
+// MultipleTransfer on opts.Parallel sub connections and the extraneous files are
+// removed. The modification time of a transferred file is set on the copy,
+// if the server supports MFMT.
+//
+// The returned report contains the planned actions and the errors of their
+// execution. Conflicts are only reported.
+func (subC *ServerSubConn) Sync(localDir string, remoteDir string, opts ftps_qftp_client.SyncOptions) (*ftps_qftp_client.SyncReport, error) {
+	actions, err := ftps_qftp_client.PlanSync(subC, localDir, remoteDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	report := &ftps_qftp_client.SyncReport{Actions: actions}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	// The root directories may be missing
+	if report.Count(ftps_qftp_client.SyncUpload) > 0 {
+		err = subC.MakeDirAll(remoteDir)
+		if err != nil {
+			return report, err
+		}
+	}
+	if report.Count(ftps_qftp_client.SyncDownload) > 0 {
+		err = os.MkdirAll(localDir, 0755)
+		if err != nil {
+			return report, errors.New("Error while creating the local directory. " + err.Error())
+		}
+	}
+
+	// The actions are sorted, a directory is created before its content
+	var tasks []TransferTask
+	for _, action := range actions {
+		localpath := filepath.Join(localDir, filepath.FromSlash(action.Path))
+		remotepath := pathpkg.Join(remoteDir, action.Path)
+		var err error
+		switch {
+		case action.Kind == ftps_qftp_client.SyncUpload && action.Dir:
+			err = subC.MakeDirAll(remotepath)
+		case action.Kind == ftps_qftp_client.SyncDownload && action.Dir:
+			err = os.MkdirAll(localpath, 0755)
+		case action.Kind == ftps_qftp_client.SyncUpload:
+			tasks = append(tasks, NewTransferTask(Store, localpath, remotepath))
+		case action.Kind == ftps_qftp_client.SyncDownload:
+			tasks = append(tasks, NewTransferTask(Retrieve, localpath, remotepath))
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+		}
+	}
+
+	if len(tasks) > 0 {
+		if opts.Parallel < 1 {
+			opts.Parallel = 1
+		}
+		err = subC.MultipleTransfer(tasks, opts.Parallel)
+		if multipleErrors, ok := err.(*ftps_qftp_client.MultipleErrors); ok {
+			report.Errors = append(report.Errors, multipleErrors.Errors...)
+		} else if err != nil {
+			report.Errors = append(report.Errors, err)
+		}
+	}
+
+	for _, action := range actions {
+		localpath := filepath.Join(localDir, filepath.FromSlash(action.Path))
+		remotepath := pathpkg.Join(remoteDir, action.Path)
+		var err error
+		switch action.Kind {
+		case ftps_qftp_client.SyncUpload:
+			if !action.Dir {
+				// Not every server supports MFMT
+				subC.SetModTime(remotepath, action.ModTime)
+			}
+		case ftps_qftp_client.SyncDownload:
+			if !action.Dir {
+				os.Chtimes(localpath, action.ModTime, action.ModTime)
+			}
+		case ftps_qftp_client.SyncDeleteRemote:
+			err = subC.RemoveAll(remotepath)
+		case ftps_qftp_client.SyncDeleteLocal:
+			err = os.RemoveAll(localpath)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+		}
+	}
+	return report, nil
+}
@@ -47,6 +47,7 @@ const (
 	StatusNotImplemented          = 502
 	StatusBadSequence             = 503
 	StatusNotImplementedParameter = 504
+	StatusDirectoryExists         = 521
 	StatusNotLoggedIn             = 530
 	StatusStorNeedAccount         = 532
 	StatusNeedTLS                 = 534
@@ -54,6 +55,7 @@ const (
 	StatusPageTypeUnknown         = 551
 	StatusExceededStorage         = 552
 	StatusBadFileName             = 553
+	StatusInvalidRestart          = 554
 )
 
 var statusText = map[int]string{
@@ -100,6 +102,7 @@ var statusText = map[int]string{
 	StatusNotImplemented:          "Command not implemented.",
 	StatusBadSequence:             "Bad sequence of commands.",
 	StatusNotImplementedParameter: "Command not implemented for that parameter.",
+	StatusDirectoryExists:         "Directory already exists.",
 	StatusNotLoggedIn:             "Not logged in.",
 	StatusStorNeedAccount:         "Need account for storing files.",
 	StatusNeedTLS:                 "AUTH TLS requrired.",
@@ -107,4 +110,5 @@ var statusText = map[int]string{
 	StatusPageTypeUnknown:         "Page type unknown.",
 	StatusExceededStorage:         "Exceeded storage allocation.",
 	StatusBadFileName:             "File name not allowed.",
+	StatusInvalidRestart:          "Requested action not taken: invalid REST parameter.",
 }
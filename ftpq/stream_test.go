@@ -0,0 +1,70 @@
+package ftpq
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDataStreams(t *testing.T) {
+	mock := newFtpMock(t)
+	subC := newMockSubConn(t, mock)
+
+	r, err := subC.Retr("welcome.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := readAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(data) != "welcome" {
+		t.Errorf("unexpected data: %q", data)
+	}
+
+	r, err = subC.RetrFrom("welcome.msg", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = readAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(data) != "come" {
+		t.Errorf("unexpected data from offset 3: %q", data)
+	}
+
+	err = subC.Stor("report.csv", strings.NewReader("date;value\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(mock.stored) != "date;value\n" {
+		t.Errorf("unexpected stored data: %q", mock.stored)
+	}
+
+	entries, err := subC.ListMachine(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "welcome.msg" || entries[0].Size != 7 || entries[1].Name != "pub" {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+
+	entry, err := subC.Stat("welcome.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "welcome.msg" || entry.Size != 7 {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+
+	subC.Quit()
+
+	// Wait for the streams to close
+	mock.Wait()
+
+	expected := []string{"HELLO", "FEAT", "USER", "PASS", "TYPE", "FEAT", "RETR", "REST", "RETR", "STOR", "MLSD", "MLST", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
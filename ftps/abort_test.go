@@ -0,0 +1,51 @@
+package ftps
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestAbortRetr(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21215"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.Retr("endless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadFull(r, make([]byte, 4096))
+	if err != nil {
+		t.Error(err)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Both replies of the abort must be read
+	err = c.NoOp()
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	expected := []string{"FEAT", "PASV", "RETR", "ABOR", "NOOP", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
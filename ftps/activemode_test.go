@@ -0,0 +1,61 @@
+package ftps
+
+import (
+	"io/ioutil"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestActiveMode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21216"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetActiveMode(ActiveModeConfig{PortMin: 21217, PortMax: 21220})
+
+	r, err := c.Retr("welcome.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(data) != "welcome" {
+		t.Errorf("unexpected data: %q", data)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	expected := []string{"FEAT", "PORT", "RETR", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
+
+func TestFormatDataAddress(t *testing.T) {
+	port := formatPortAddress(net.ParseIP("192.168.1.2"), 50001)
+	if port != "192,168,1,2,195,81" {
+		t.Errorf("unexpected PORT argument: %s", port)
+	}
+	eprt := formatEprtAddress(net.ParseIP("2001:db8::1"), 50001)
+	if eprt != "|2|2001:db8::1|50001|" {
+		t.Errorf("unexpected EPRT argument: %s", eprt)
+	}
+}
@@ -1,75 +1,516 @@
 package ftps
 
 import (
+	"compress/zlib"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/attenberger/ftps_qftp-client"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/textproto"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type ftpMock struct {
-	listener net.Listener
-	commands []string // list of received commands
+	listener  net.Listener
+	tlsConfig *tls.Config       // for AUTH TLS and the protected data connections
+	commands  []string          // list of received commands
+	stored    []byte            // data of the last STOR or STOU, extended by APPE
+	files     map[string][]byte // stored files by path
+	dirs      map[string]bool   // created directories
+	removed   []string          // paths removed with DELE and RMD
+
+	noMachineListing    bool       // MLST and MLSD are not in the features
+	noHash              bool       // HASH is not in the features, only XMD5 is implemented
+	requireSessionReuse bool       // data connections must resume the TLS session
+	rejectRest          bool       // REST is not implemented
+	rejectSize          bool       // SIZE is not implemented
+	inOrderRest         bool       // REST beyond the end of the stored file is rejected
+	lock                sync.Mutex // for the parallel connections
 	sync.WaitGroup
 }
 
+// mockTree contains the LIST lines of the directories of the mock, the
+// files contain "welcome"
+var mockTree = map[string][]string{
+	"tree": {
+		"drwxr-xr-x 2 ftp ftp 4096 Aug 13  2015 sub",
+		"-rw-r--r-- 1 ftp ftp    7 Aug 13  2015 a.txt",
+		"lrwxrwxrwx 1 ftp ftp    5 Aug 13  2015 link -> a.txt",
+	},
+	"tree/sub": {
+		"-rw-r--r-- 1 ftp ftp    7 Aug 13  2015 b.txt",
+	},
+}
+
+// mockMachineTree contains the MLSD lines of the directories of mockTree
+var mockMachineTree = map[string][]string{
+	"tree": {
+		"type=cdir;modify=20150813000000;unix.mode=0755; tree",
+		"type=dir;modify=20150813000000;unix.mode=0755; sub",
+		"type=file;size=7;modify=20150813000000;unix.mode=0644; a.txt",
+		"type=OS.unix=slink:a.txt;size=5;modify=20150813000000;unix.mode=0777; link",
+	},
+	"tree/sub": {
+		"type=cdir;modify=20150813000000;unix.mode=0755; tree/sub",
+		"type=pdir;modify=20150813000000;unix.mode=0755; ..",
+		"type=file;size=7;modify=20150813000000;unix.mode=0644; b.txt",
+	},
+}
+
+// mockFacts returns the facts of the path in mockMachineTree for MLST
+func mockFacts(path string) (string, bool) {
+	if path == "tree" {
+		return "type=dir;modify=20150813000000;unix.mode=0755;", true
+	}
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return "", false
+	}
+	for _, line := range mockMachineTree[path[:i]] {
+		facts := strings.SplitN(line, " ", 2)
+		if facts[1] == path[i+1:] {
+			return facts[0], true
+		}
+	}
+	return "", false
+}
+
+// largeFile is the content of large.bin
+var largeFile = func() []byte {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}()
+
 func newFtpMock(t *testing.T, addresss string) *ftpMock {
+	return newFtpMockConfig(t, addresss, nil, false)
+}
+
+// newFtpMockTLS creates a mock for implicit FTPS
+func newFtpMockTLS(t *testing.T, addresss string, tlsConfig *tls.Config) *ftpMock {
+	return newFtpMockConfig(t, addresss, tlsConfig, true)
+}
+
+// newFtpMockConfig creates a mock, which supports AUTH TLS if tlsConfig is
+// not nil or expects implicit FTPS
+func newFtpMockConfig(t *testing.T, addresss string, tlsConfig *tls.Config, implicit bool) *ftpMock {
 	var err error
-	mock := &ftpMock{}
+	mock := &ftpMock{tlsConfig: tlsConfig, files: make(map[string][]byte), dirs: make(map[string]bool)}
+	for dir := range mockTree {
+		mock.dirs[dir] = true
+	}
 	mock.listener, err = net.Listen("tcp", addresss)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if implicit {
+		mock.listener = tls.NewListener(mock.listener, tlsConfig)
+	}
 
-	go func() {
-		// Listen for an incoming connection.
-		conn, err := mock.listener.Accept()
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		mock.Add(1)
+	// serve handles a control connection
+	serve := func(conn net.Conn) {
 		defer mock.Done()
 		defer conn.Close()
 
+		rawConn := conn
+		tlsConn, _ := conn.(*tls.Conn)
+		if tlsConn != nil {
+			rawConn = tlsConn.NetConn()
+		}
+		dataProtected := implicit
+
 		proto := textproto.NewConn(conn)
 		proto.Writer.PrintfLine("220 FTP Server ready.")
 
+		var dataListener net.Listener
+		var dataConn net.Conn
+		var activeAddr string
+		var compressed bool
+		hashAlgorithm := ftps_qftp_client.HashSHA256
+		var transferDone chan struct{}
+		var restOffset int
+
 		for {
-			command, _ := proto.ReadLine()
+			command, err := proto.ReadLine()
+			if err != nil {
+				// e.g. failed TLS handshake
+				return
+			}
 
-			// Strip the arguments
+			// Strip the arguments and the Telnet IP and Synch
+			argument := ""
 			if i := strings.Index(command, " "); i > 0 {
+				argument = command[i+1:]
 				command = command[:i]
 			}
+			command = strings.TrimLeft(command, "\xff\xf4\xf2")
+			if command == "PROT" {
+				command = command + " " + argument
+			}
 
 			// Append to list of received commands
+			mock.lock.Lock()
 			mock.commands = append(mock.commands, command)
+			mock.lock.Unlock()
 
 			// At least one command must have a multiline response
 			switch command {
 			case "FEAT":
-				proto.Writer.PrintfLine("211-Features:\r\nFEAT\r\nPASV\r\nSIZE\r\n211 End")
+				features := "FEAT\r\nPASV\r\nSIZE\r\n MODE Z\r\n REST STREAM"
+				if !mock.noHash {
+					features += "\r\n HASH SHA-256*;SHA-1;MD5;CRC32"
+				}
+				if !mock.noMachineListing {
+					features += "\r\n MLST type*;size*;modify*;unix.mode*;"
+				}
+				proto.Writer.PrintfLine("211-Features:\r\n%s\r\n211 End", features)
 			case "USER":
 				proto.Writer.PrintfLine("331 Please send your password")
 			case "PASS":
 				proto.Writer.PrintfLine("230-Hey,\r\nWelcome to my FTP\r\n230 Access granted")
 			case "TYPE":
 				proto.Writer.PrintfLine("200 Type set ok")
+			case "SIZE":
+				if mock.rejectSize {
+					proto.Writer.PrintfLine("502 SIZE not implemented.")
+				} else if argument == "report.csv" {
+					proto.Writer.PrintfLine("213 %d", len(mock.stored))
+				} else if argument == "large.bin" {
+					proto.Writer.PrintfLine("213 %d", len(largeFile))
+				} else if strings.HasPrefix(argument, "tree/") {
+					proto.Writer.PrintfLine("213 %d", len("welcome"))
+				} else {
+					proto.Writer.PrintfLine("213 951")
+				}
+			case "REST":
+				if mock.rejectRest {
+					proto.Writer.PrintfLine("502 REST not implemented.")
+					break
+				}
+				restOffset, err = strconv.Atoi(argument)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				proto.Writer.PrintfLine("350 Restarting at %d.", restOffset)
+			case "MDTM":
+				proto.Writer.PrintfLine("213 20150813175250")
+			case "MFMT":
+				proto.Writer.PrintfLine("213 Modify=20150813175250; welcome.msg")
+			case "CWD":
+				// Slow reply to test interrupted commands
+				time.Sleep(200 * time.Millisecond)
+				proto.Writer.PrintfLine("250 Directory successfully changed.")
+			case "MKD":
+				mock.lock.Lock()
+				exists := mock.dirs[argument]
+				mock.dirs[argument] = true
+				mock.lock.Unlock()
+				if exists {
+					proto.Writer.PrintfLine("550 Create directory operation failed.")
+				} else {
+					proto.Writer.PrintfLine("257 \"%s\" created", argument)
+				}
+			case "DELE":
+				mock.lock.Lock()
+				isDir := mock.dirs[argument]
+				if !isDir && argument != "tree/sub/b.txt" {
+					mock.removed = append(mock.removed, argument)
+				}
+				mock.lock.Unlock()
+				if isDir {
+					proto.Writer.PrintfLine("550 Delete operation failed.")
+				} else if argument == "tree/sub/b.txt" {
+					proto.Writer.PrintfLine("550 Permission denied.")
+				} else {
+					proto.Writer.PrintfLine("250 Delete operation successful.")
+				}
+			case "RMD":
+				mock.lock.Lock()
+				mock.removed = append(mock.removed, argument)
+				mock.lock.Unlock()
+				proto.Writer.PrintfLine("250 Remove directory operation successful.")
+			case "PWD":
+				proto.Writer.PrintfLine("257 \"/\" is the current directory.")
+			case "NOOP":
+				proto.Writer.PrintfLine("200 NOOP ok.")
+			case "PASV":
+				dataListener, err = net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				port := dataListener.Addr().(*net.TCPAddr).Port
+				proto.Writer.PrintfLine("227 Entering Passive Mode (127,0,0,1,%d,%d).", port/256, port%256)
+			case "AUTH":
+				proto.Writer.PrintfLine("234 Proceed with negotiation.")
+				tlsConn = tls.Server(rawConn, mock.tlsConfig)
+				proto = textproto.NewConn(tlsConn)
+			case "CCC":
+				proto.Writer.PrintfLine("200 Control connection cleared.")
+				// Exchange close_notify
+				_, err = io.Copy(ioutil.Discard, tlsConn)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				tlsConn.CloseWrite()
+				rawConn.SetDeadline(time.Time{})
+				tlsConn = nil
+				proto = textproto.NewConn(rawConn)
+			case "PBSZ":
+				proto.Writer.PrintfLine("200 PBSZ=0")
+			case "PROT P":
+				dataProtected = true
+				proto.Writer.PrintfLine("200 PROT now Private.")
+			case "PROT C":
+				dataProtected = false
+				proto.Writer.PrintfLine("200 PROT now Clear.")
+			case "PORT":
+				var h1, h2, h3, h4, p1, p2 int
+				_, err = fmt.Sscanf(argument, "%d,%d,%d,%d,%d,%d", &h1, &h2, &h3, &h4, &p1, &p2)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				activeAddr = fmt.Sprintf("%d.%d.%d.%d:%d", h1, h2, h3, h4, p1*256+p2)
+				proto.Writer.PrintfLine("200 PORT command successful.")
+			case "MODE":
+				compressed = argument == "Z"
+				proto.Writer.PrintfLine("200 Mode set to %s.", argument)
+			case "OPTS":
+				if strings.HasPrefix(argument, "HASH ") {
+					hashAlgorithm = ftps_qftp_client.HashAlgorithm(argument[5:])
+				}
+				proto.Writer.PrintfLine("200 OPTS ok.")
+			case "XSHA256", "XSHA1", "XCRC":
+				proto.Writer.PrintfLine("502 Command not implemented.")
+			case "HASH", "XMD5":
+				algorithm := hashAlgorithm
+				if command == "XMD5" {
+					algorithm = ftps_qftp_client.HashMD5
+				}
+				// The files are corrupted on the server
+				data := []byte("welcome")
+				if argument == "corrupt.bin" {
+					data = []byte("corrupted")
+				} else if argument == "report.csv" {
+					data = mock.stored
+				}
+				h, err := algorithm.New()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				h.Write(data)
+				sum := fmt.Sprintf("%x", h.Sum(nil))
+				if command == "XMD5" {
+					proto.Writer.PrintfLine("250 %s", sum)
+				} else {
+					proto.Writer.PrintfLine("213 %s 0-%d %s %s", algorithm, len(data), sum, argument)
+				}
+			case "STOR", "APPE", "STOU":
+				mock.lock.Lock()
+				offset := restOffset
+				restOffset = 0
+				if command == "APPE" {
+					offset = len(mock.stored)
+				} else if offset == 0 {
+					// A new file or truncated
+					mock.stored = nil
+				}
+				outOfOrder := mock.inOrderRest && offset > len(mock.stored)
+				mock.lock.Unlock()
+				if outOfOrder {
+					proto.Writer.PrintfLine("554 Invalid REST parameter.")
+					break
+				}
+				if command == "STOU" {
+					proto.Writer.PrintfLine("150 FILE: upload.1")
+				} else {
+					proto.Writer.PrintfLine("150 Ok to send data.")
+				}
+				dataConn, err = mock.openDataConn(dataListener, activeAddr, dataProtected)
+				if err != nil {
+					proto.Writer.PrintfLine("522 %s", err)
+					break
+				}
+				var r io.Reader = dataConn
+				if compressed {
+					r, err = zlib.NewReader(dataConn)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+				data, err := ioutil.ReadAll(r)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				// Write the data at the offset
+				mock.lock.Lock()
+				if len(mock.stored) < offset+len(data) {
+					mock.stored = append(mock.stored, make([]byte, offset+len(data)-len(mock.stored))...)
+				}
+				copy(mock.stored[offset:], data)
+				mock.files[argument] = mock.stored
+				mock.lock.Unlock()
+				dataConn.Close()
+				proto.Writer.PrintfLine("226 Transfer complete.")
+			case "LIST":
+				proto.Writer.PrintfLine("150 Here comes the directory listing.")
+				dataConn, err = mock.openDataConn(dataListener, activeAddr, dataProtected)
+				if err != nil {
+					proto.Writer.PrintfLine("522 %s", err)
+					break
+				}
+				for _, line := range mockTree[argument] {
+					fmt.Fprintf(dataConn, "%s\r\n", line)
+				}
+				dataConn.Close()
+				proto.Writer.PrintfLine("226 Directory send OK.")
+			case "MLSD":
+				lines, ok := mockMachineTree[argument]
+				if !ok {
+					proto.Writer.PrintfLine("550 Failed to open directory.")
+					break
+				}
+				proto.Writer.PrintfLine("150 Here comes the directory listing.")
+				dataConn, err = mock.openDataConn(dataListener, activeAddr, dataProtected)
+				if err != nil {
+					proto.Writer.PrintfLine("522 %s", err)
+					break
+				}
+				for _, line := range lines {
+					fmt.Fprintf(dataConn, "%s\r\n", line)
+				}
+				dataConn.Close()
+				proto.Writer.PrintfLine("226 Directory send OK.")
+			case "MLST":
+				facts, ok := mockFacts(argument)
+				if !ok {
+					proto.Writer.PrintfLine("550 No such file or directory.")
+					break
+				}
+				proto.Writer.PrintfLine("250-Listing %s\r\n %s %s\r\n250 End", argument, facts, argument)
+			case "RETR":
+				if argument == "missing.csv" {
+					proto.Writer.PrintfLine("550 Failed to open file.")
+					break
+				}
+				proto.Writer.PrintfLine("150 Opening BINARY mode data connection.")
+				dataConn, err = mock.openDataConn(dataListener, activeAddr, dataProtected)
+				if err != nil {
+					proto.Writer.PrintfLine("522 %s", err)
+					break
+				}
+				if argument != "endless" {
+					data := []byte("welcome")
+					if argument == "text.txt" {
+						data = []byte("line1\r\nline2\r\n")
+					} else if argument == "report.csv" {
+						data = mock.stored
+					} else if argument == "large.bin" {
+						data = largeFile
+					}
+					data = data[restOffset:]
+					restOffset = 0
+					if compressed {
+						zw := zlib.NewWriter(dataConn)
+						zw.Write(data)
+						zw.Close()
+					} else {
+						dataConn.Write(data)
+					}
+					dataConn.Close()
+					proto.Writer.PrintfLine("226 Transfer complete.")
+					break
+				}
+				// Send data until the connection is closed
+				transferDone = make(chan struct{})
+				go func() {
+					defer close(transferDone)
+					buf := make([]byte, 1024)
+					for {
+						if _, err := dataConn.Write(buf); err != nil {
+							return
+						}
+					}
+				}()
+			case "ABOR":
+				dataConn.Close()
+				if transferDone == nil {
+					// The transfer was already complete
+					proto.Writer.PrintfLine("226 ABOR successful.")
+					break
+				}
+				<-transferDone
+				proto.Writer.PrintfLine("426 Failure writing network stream.")
+				proto.Writer.PrintfLine("226 ABOR successful.")
 			case "QUIT":
 				proto.Writer.PrintfLine("221 Goodbye.")
 				return
 			default:
-				t.Fatal("unknown command:", command)
+				t.Error("unknown command:", command)
+				return
 			}
 		}
+	}
+
+	go func() {
+		for {
+			// Listen for incoming connections, several for parallel transfers
+			conn, err := mock.listener.Accept()
+			if err != nil {
+				return
+			}
+			mock.Add(1)
+			go serve(conn)
+		}
 	}()
 
 	return mock
 }
 
+// openDataConn opens the data connection in passive or active mode
+func (mock *ftpMock) openDataConn(dataListener net.Listener, activeAddr string, protected bool) (net.Conn, error) {
+	var dataConn net.Conn
+	var err error
+	if activeAddr != "" {
+		dataConn, err = net.Dial("tcp", activeAddr)
+	} else {
+		dataConn, err = dataListener.Accept()
+		dataListener.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !protected {
+		return dataConn, nil
+	}
+
+	tlsDataConn := tls.Server(dataConn, mock.tlsConfig)
+	if mock.requireSessionReuse {
+		err = tlsDataConn.Handshake()
+		if err != nil || !tlsDataConn.ConnectionState().DidResume {
+			dataConn.Close()
+			return nil, errors.New("SSL connection failed: session reuse required")
+		}
+	}
+	return tlsDataConn, nil
+}
+
 // Closes the listening socket
 func (mock *ftpMock) Close() {
 	mock.listener.Close()
@@ -1,7 +1,15 @@
 // Commandline for the FTP-Client to access an FTP-Server over FTPS
-// Arguments for starting the client are -cert (mandatory), -host and -port
-// to specify the servers TLS-/X.509-certificate (filename), his hostname and
-// controlport.
+// Arguments for starting the client are -cert, -host and -port
+// to specify the servers TLS-/X.509-certificate or CA (filename), his hostname and
+// controlport. Without -cert the certificate is verified with the system roots.
+// With -pin the certificate must have one of the comma separated SHA-256
+// fingerprints, -insecure disables the verification.
+// For mutual TLS -clientcert and -clientkey specify the certificate and the
+// private key of the client, -keypass the password of an encrypted key.
+// With -implicit the connection uses implicit FTPS (usually port 990).
+// With -active the data connections are opened by the server (PORT/EPRT),
+// -externalip and -portrange (e.g. 50000-50100) configure the announced
+// address and the local ports to listen on.
 
 package main
 
@@ -13,7 +21,6 @@ import (
 	"github.com/attenberger/ftps_qftp-client"
 	"github.com/attenberger/ftps_qftp-client/ftps"
 	"io"
-	"log"
 	"os"
 	"os/user"
 	"strconv"
@@ -21,20 +28,48 @@ import (
 	"time"
 )
 
+// consoleReader reads the commands and the answers of the user
+var consoleReader = bufio.NewReader(os.Stdin)
+
 func main() {
 	// Parse commandline flags
 	var (
-		port = flag.Int("port", 2121, "Port")
-		host = flag.String("host", "localhost", "Port")
-		cert = flag.String("cert", "", "Path to server certificate for TLS")
+		port       = flag.Int("port", 2121, "Port")
+		host       = flag.String("host", "localhost", "Port")
+		cert       = flag.String("cert", "", "Path to server certificate or CA for TLS")
+		pin        = flag.String("pin", "", "Comma separated SHA-256 fingerprints of accepted server certificates")
+		insecure   = flag.Bool("insecure", false, "Accept every server certificate")
+		clientcert = flag.String("clientcert", "", "Path to client certificate for mutual TLS")
+		clientkey  = flag.String("clientkey", "", "Path to private key of the client certificate")
+		keypass    = flag.String("keypass", "", "Password of an encrypted private key")
+		implicit   = flag.Bool("implicit", false, "Use implicit FTPS, TLS before the greeting of the server")
+		active     = flag.Bool("active", false, "Use active mode for data connections")
+		externalIP = flag.String("externalip", "", "IP address announced to the server in active mode")
+		portRange  = flag.String("portrange", "", "Local ports for data connections in active mode, e.g. 50000-50100")
 	)
 	flag.Parse()
-	messageAboutMissingParameters := ""
-	if *cert == "" {
-		messageAboutMissingParameters = messageAboutMissingParameters + "Please set a certificatefile for the server with -cert\n"
+	tlsOptions := ftps_qftp_client.TLSOptions{}
+	switch {
+	case *insecure:
+		tlsOptions.Trust = ftps_qftp_client.TrustInsecure
+	case *pin != "":
+		tlsOptions.Trust = ftps_qftp_client.TrustPinned
+		tlsOptions.Pins = strings.Split(*pin, ",")
+	case *cert != "":
+		tlsOptions.Trust = ftps_qftp_client.TrustCAFile
+		tlsOptions.CAFile = *cert
 	}
-	if messageAboutMissingParameters != "" {
-		log.Fatalf(messageAboutMissingParameters)
+	tlsOptions.CertFile = *clientcert
+	tlsOptions.KeyFile = *clientkey
+	tlsOptions.KeyPassword = *keypass
+	activeModeConfig := ftps.ActiveModeConfig{ExternalIP: *externalIP}
+	if *portRange != "" {
+		var err error
+		activeModeConfig.PortMin, activeModeConfig.PortMax, err = parsePortRange(*portRange)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
 	}
 
 	// set working directory
@@ -49,14 +84,17 @@ func main() {
 
 	// prepare necessary utils
 	commandMap := generateFunctionsMap()
-	consoleReader := bufio.NewReader(os.Stdin)
 
 	// setup ftp connection
-	connection, err := ftps.DialTimeout(*host+":"+strconv.Itoa(*port), time.Second*30, *cert)
+	connection, err := ftps.DialWithConfig(*host+":"+strconv.Itoa(*port), ftps.DialConfig{Timeout: time.Second * 30, TLS: tlsOptions, Implicit: *implicit})
 	if err != nil {
 		fmt.Println("Error opening connection to server: " + err.Error())
 		return
 	}
+	if *active {
+		connection.SetActiveMode(activeModeConfig)
+	}
+	connection.SetProgressFunc(printProgress)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
@@ -106,19 +144,76 @@ func main() {
 	}
 }
 
+// Parses a port range like 50000-50100
+func parsePortRange(portRange string) (int, int, error) {
+	ports := strings.SplitN(portRange, "-", 2)
+	portMin, err := strconv.Atoi(ports[0])
+	if err != nil {
+		return 0, 0, errors.New("Invalid port range " + portRange + ".")
+	}
+	portMax := portMin
+	if len(ports) == 2 {
+		portMax, err = strconv.Atoi(ports[1])
+		if err != nil || portMax < portMin {
+			return 0, 0, errors.New("Invalid port range " + portRange + ".")
+		}
+	}
+	return portMin, portMax, nil
+}
+
 // Generates a map of functions for all supported commands of the userinterface.
 // The commands are not necessarily FTP-Commands.
 func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, parameters ...string) error {
 
 	var functions = make(map[string]func(connection *ftps.ServerConn, parameters ...string) error)
 
+	functions["APPE"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) != 2 {
+			return errors.New("APPE needs two parameter.")
+		}
+		localpath := parameters[0]
+		remotepath := parameters[1]
+
+		file, err := os.Open(localpath)
+		defer file.Close()
+		if err != nil {
+			return errors.New("Error while opening the local file. " + err.Error())
+		}
+
+		err = connection.Append(remotepath, file)
+		if err != nil {
+			return errors.New("Error while appending file to server. " + err.Error())
+		}
+		return nil
+	}
+
 	functions["AUTH"] = func(connection *ftps.ServerConn, parameters ...string) error {
-		if len(parameters) != 1 {
-			return errors.New("Please use AUTH-command in the following pattern \"AUTH Method\".")
+		if len(parameters) < 1 || len(parameters) > 3 {
+			return errors.New("Please use AUTH-command in the following pattern \"AUTH Method [P|C] [CCC]\".")
 		} else if strings.ToUpper(parameters[0]) != "TLS" {
 			return errors.New("Just TLS authentication method is supported.")
 		}
-		return connection.AuthTLS()
+		options := ftps.AuthTLSOptions{}
+		for _, parameter := range parameters[1:] {
+			switch strings.ToUpper(parameter) {
+			case "P":
+				options.Protection = ftps.ProtectionPrivate
+			case "C":
+				options.Protection = ftps.ProtectionClear
+			case "CCC":
+				options.ClearCommandChannel = true
+			default:
+				return errors.New("Unknown AUTH mode " + parameter + ", P and C set the protection of the data connections, CCC clears the control connection after login.")
+			}
+		}
+		return connection.AuthTLSWithOptions(options)
+	}
+
+	functions["CCC"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) != 0 {
+			return errors.New("CCC accepts no parameter.")
+		}
+		return connection.ClearCommandChannel()
 	}
 
 	functions["CDUP"] = func(connection *ftps.ServerConn, parameters ...string) error {
@@ -159,6 +254,22 @@ func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, paramet
 		return nil
 	}
 
+	functions["HASH"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) < 1 || len(parameters) > 2 {
+			return errors.New("Please use HASH-command in the following pattern \"HASH Path [SHA-256|SHA-1|MD5|CRC32]\".")
+		}
+		algorithm := ftps_qftp_client.HashSHA256
+		if len(parameters) == 2 {
+			algorithm = ftps_qftp_client.HashAlgorithm(strings.ToUpper(parameters[1]))
+		}
+		checksum, err := connection.Hash(parameters[0], algorithm)
+		if err != nil {
+			return err
+		}
+		fmt.Println("  " + string(algorithm) + " " + checksum)
+		return nil
+	}
+
 	functions["LIST"] = func(connection *ftps.ServerConn, parameters ...string) error {
 		var entrys []*ftps_qftp_client.Entry
 		var err error
@@ -174,18 +285,7 @@ func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, paramet
 			return err
 		}
 		for _, entry := range entrys {
-			var typeChar string
-			switch entry.Type {
-			case ftps_qftp_client.EntryTypeFile:
-				typeChar = "-"
-			case ftps_qftp_client.EntryTypeFolder:
-				typeChar = "d"
-			case ftps_qftp_client.EntryTypeLink:
-				typeChar = "l"
-			default:
-				typeChar = "?"
-			}
-			fmt.Printf("  %s %12d %20s %s\n", typeChar, entry.Size, entry.Time.String(), entry.Name)
+			printEntry(entry)
 		}
 		return nil
 	}
@@ -204,18 +304,92 @@ func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, paramet
 		return connection.Logout()
 	}
 
+	functions["MDTM"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("MDTM needs one parameter.")
+		}
+		modTime, err := connection.ModTime(parameters[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println("  " + modTime.String())
+		return nil
+	}
+
+	functions["MFMT"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) != 2 {
+			return errors.New("Please use MFMT-command in the following pattern \"MFMT YYYYMMDDHHMMSS Path\".")
+		}
+		modTime, err := time.Parse("20060102150405", parameters[0])
+		if err != nil {
+			return errors.New("Error converting the time. " + err.Error())
+		}
+		return connection.SetModTime(parameters[1], modTime)
+	}
+
+	functions["MGET"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) < 3 || len(parameters) > 4 || parameters[0] != "-r" {
+			return errors.New("Please use MGET-command in the following pattern \"MGET -r Remotedir Localdir [Parallel]\", " +
+				"it retrieves the directory tree with the given number of parallel connections.")
+		}
+		opts := ftps_qftp_client.DirTransferOptions{Parallel: 1}
+		if len(parameters) == 4 {
+			var err error
+			opts.Parallel, err = strconv.Atoi(parameters[3])
+			if err != nil {
+				return errors.New("Error converting number of parallel connections. " + err.Error())
+			}
+		}
+		return connection.DownloadDir(parameters[1], parameters[2], opts)
+	}
+
 	functions["MKD"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) == 2 && parameters[0] == "-p" {
+			return connection.MakeDirAll(parameters[1])
+		}
 		if len(parameters) < 1 {
-			return errors.New("MKD needs one parameter.")
+			return errors.New("MKD needs one parameter, with -p the missing parent directories are created.")
 		}
 		return connection.MakeDir(parameters[0])
 	}
 
+	functions["MPUT"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		opts := ftps_qftp_client.DirTransferOptions{Parallel: 1}
+		recursive := false
+		for len(parameters) > 0 && strings.HasPrefix(parameters[0], "-") {
+			switch parameters[0] {
+			case "-r":
+				recursive = true
+			case "-L":
+				opts.Symlinks = ftps_qftp_client.FollowSymlinks
+			default:
+				return errors.New("Unknown option " + parameters[0] + ".")
+			}
+			parameters = parameters[1:]
+		}
+		if !recursive || len(parameters) < 2 || len(parameters) > 3 {
+			return errors.New("Please use MPUT-command in the following pattern \"MPUT -r [-L] Localdir Remotedir [Parallel]\", " +
+				"it stores the directory tree with the given number of parallel connections, -L follows symbolic links.")
+		}
+		if len(parameters) == 3 {
+			var err error
+			opts.Parallel, err = strconv.Atoi(parameters[2])
+			if err != nil {
+				return errors.New("Error converting number of parallel connections. " + err.Error())
+			}
+		}
+		return connection.UploadDir(parameters[0], parameters[1], opts)
+	}
+
 	functions["MTRAN"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		resume := len(parameters) > 0 && parameters[0] == "-c"
+		if resume {
+			parameters = parameters[1:]
+		}
 		if len(parameters) < 4 || len(parameters)%3 != 1 {
 			return errors.New("MTRAN needs at least four parameters. The first has to be the number of parallel connection, " +
 				"the rest each a triple of transferdirection, local- and remotepath. Transferdirection is indicated by \"<\" " +
-				" (retrieve from Server) and \">\" (store at server).")
+				" (retrieve from Server) and \">\" (store at server). With -c as first parameter interrupted transfers are continued.")
 		}
 		parallelConnection, err := strconv.Atoi(parameters[0])
 		if err != nil {
@@ -232,7 +406,11 @@ func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, paramet
 			default:
 				return errors.New(parameters[i] + " is not a vaild transfer direction. \"<\" or \">\" expected.")
 			}
-			tasks = append(tasks, ftps.NewTransferTask(direction, parameters[i+1], parameters[i+2]))
+			if resume {
+				tasks = append(tasks, ftps.NewResumeTransferTask(direction, parameters[i+1], parameters[i+2]))
+			} else {
+				tasks = append(tasks, ftps.NewTransferTask(direction, parameters[i+1], parameters[i+2]))
+			}
 		}
 		err = connection.MultipleTransfer(tasks, parallelConnection)
 		if err != nil {
@@ -241,6 +419,59 @@ func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, paramet
 		return nil
 	}
 
+	functions["MLSD"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		var entrys []*ftps_qftp_client.Entry
+		var err error
+		switch len(parameters) {
+		case 0:
+			entrys, err = connection.ListMachine(".")
+		case 1:
+			entrys, err = connection.ListMachine(parameters[0])
+		default:
+			return errors.New("MLSD needs one or no parameter.")
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entrys {
+			printEntry(entry)
+		}
+		return nil
+	}
+
+	functions["MLST"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("MLST needs one parameter.")
+		}
+		entry, err := connection.Stat(parameters[0])
+		if err != nil {
+			return err
+		}
+		printEntry(entry)
+		return nil
+	}
+
+	functions["MODE"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) < 1 || len(parameters) > 2 {
+			return errors.New("Please use MODE-command in the following pattern \"MODE Z [Level]\" or \"MODE S\".")
+		}
+		switch strings.ToUpper(parameters[0]) {
+		case "S":
+			return connection.DisableCompression()
+		case "Z":
+			level := -1
+			if len(parameters) == 2 {
+				var err error
+				level, err = strconv.Atoi(parameters[1])
+				if err != nil || level < 1 || level > 9 {
+					return errors.New("The compression level must be between 1 and 9.")
+				}
+			}
+			return connection.EnableCompression(level)
+		}
+		return errors.New("Just the modes S (stream) and Z (compressed) are supported.")
+	}
+
 	functions["NLST"] = func(connection *ftps.ServerConn, parameters ...string) error {
 		var entrys []string
 		var err error
@@ -295,12 +526,20 @@ func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, paramet
 	}
 
 	functions["RETR"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		resume := len(parameters) > 0 && parameters[0] == "-c"
+		if resume {
+			parameters = parameters[1:]
+		}
 		if len(parameters) != 2 {
-			return errors.New("RETR needs two parameter.")
+			return errors.New("Please use RETR-command in the following pattern \"RETR [-c] Localpath Remotepath\", -c continues an interrupted download.")
 		}
 		localpath := parameters[0]
 		remotepath := parameters[1]
 
+		if resume {
+			return connection.ResumeRetr(remotepath, localpath)
+		}
+
 		if _, err := os.Stat(localpath); os.IsExist(err) {
 			return errors.New("File with this name already exists in local folder.")
 		}
@@ -330,6 +569,33 @@ func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, paramet
 		return nil
 	}
 
+	functions["RM"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		recursive := len(parameters) > 0 && parameters[0] == "-r"
+		if recursive {
+			parameters = parameters[1:]
+		}
+		if len(parameters) < 1 || len(parameters) > 2 || (!recursive && len(parameters) != 1) {
+			return errors.New("Please use RM-command in the following pattern \"RM [-r] Remotepath [Parallel]\", " +
+				"-r removes the directory tree with the given number of parallel connections.")
+		}
+		if !recursive {
+			return connection.Delete(parameters[0])
+		}
+		parallel := 1
+		if len(parameters) == 2 {
+			var err error
+			parallel, err = strconv.Atoi(parameters[1])
+			if err != nil {
+				return errors.New("Error converting number of parallel connections. " + err.Error())
+			}
+		}
+		if !confirm("Remove " + parameters[0] + " with its whole content?") {
+			fmt.Println("  Nothing removed.")
+			return nil
+		}
+		return connection.RemoveAllParallel(parameters[0], parallel)
+	}
+
 	functions["RMD"] = func(connection *ftps.ServerConn, parameters ...string) error {
 		if len(parameters) < 1 {
 			return errors.New("RKD needs one parameter.")
@@ -337,13 +603,89 @@ func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, paramet
 		return connection.RemoveDir(parameters[0])
 	}
 
+	functions["SYNC"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		opts := ftps_qftp_client.SyncOptions{Mode: ftps_qftp_client.SyncBidirectional, Parallel: 1}
+		for len(parameters) > 0 && strings.HasPrefix(parameters[0], "-") {
+			switch parameters[0] {
+			case "-up":
+				opts.Mode = ftps_qftp_client.SyncMirrorUpload
+			case "-down":
+				opts.Mode = ftps_qftp_client.SyncMirrorDownload
+			case "-both":
+				opts.Mode = ftps_qftp_client.SyncBidirectional
+			case "-delete":
+				opts.DeleteExtraneous = true
+			case "-n":
+				opts.DryRun = true
+			case "-hash":
+				if len(parameters) < 2 {
+					return errors.New("-hash needs the name of the algorithm.")
+				}
+				opts.Hash = ftps_qftp_client.HashAlgorithm(strings.ToUpper(parameters[1]))
+				parameters = parameters[1:]
+			default:
+				return errors.New("Unknown option " + parameters[0] + ".")
+			}
+			parameters = parameters[1:]
+		}
+		if len(parameters) < 2 || len(parameters) > 3 {
+			return errors.New("Please use SYNC-command in the following pattern \"SYNC [-up|-down|-both] [-delete] [-n] [-hash Algorithm] Localdir Remotedir [Parallel]\", " +
+				"-up and -down mirror in one direction, -both copies the newer files, -delete removes extraneous files of a mirror, -n only shows the actions.")
+		}
+		if len(parameters) == 3 {
+			var err error
+			opts.Parallel, err = strconv.Atoi(parameters[2])
+			if err != nil {
+				return errors.New("Error converting number of parallel connections. " + err.Error())
+			}
+		}
+		report, err := connection.Sync(parameters[0], parameters[1], opts)
+		if err != nil {
+			return err
+		}
+		for _, action := range report.Actions {
+			fmt.Println("  " + action.Kind.String() + " " + action.Path + " (" + action.Reason + ")")
+		}
+		if len(report.Actions) == 0 {
+			fmt.Println("  The directories are synchronized.")
+		}
+		if len(report.Errors) > 0 {
+			return &ftps_qftp_client.MultipleErrors{Errors: report.Errors}
+		}
+		return nil
+	}
+
+	functions["SIZE"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("SIZE needs one parameter.")
+		}
+		size, err := connection.FileSize(parameters[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  %d\n", size)
+		return nil
+	}
+
 	functions["STOR"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		resume := len(parameters) > 0 && parameters[0] == "-c"
+		if resume {
+			parameters = parameters[1:]
+		}
 		if len(parameters) != 2 {
-			return errors.New("STOR needs two parameter.")
+			return errors.New("Please use STOR-command in the following pattern \"STOR [-c] Localpath Remotepath\", -c continues an interrupted upload.")
 		}
 		localpath := parameters[0]
 		remotepath := parameters[1]
 
+		if resume {
+			err := connection.ResumeStor(localpath, remotepath)
+			if err != nil {
+				return errors.New("Error while writing file to server. " + err.Error())
+			}
+			return nil
+		}
+
 		file, err := os.Open(localpath)
 		defer file.Close()
 		if err != nil {
@@ -357,5 +699,120 @@ func generateFunctionsMap() map[string]func(connection *ftps.ServerConn, paramet
 		return nil
 	}
 
+	functions["STOU"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("STOU needs one parameter.")
+		}
+
+		file, err := os.Open(parameters[0])
+		defer file.Close()
+		if err != nil {
+			return errors.New("Error while opening the local file. " + err.Error())
+		}
+
+		name, err := connection.StorUnique(file)
+		if err != nil {
+			return errors.New("Error while writing file to server. " + err.Error())
+		}
+		fmt.Println("  " + name)
+		return nil
+	}
+
+	functions["TYPE"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("Please use TYPE-command in the following pattern \"TYPE A|I\".")
+		}
+		switch strings.ToUpper(parameters[0]) {
+		case "A":
+			return connection.SetTransferType(ftps_qftp_client.TransferTypeASCII)
+		case "I":
+			return connection.SetTransferType(ftps_qftp_client.TransferTypeBinary)
+		}
+		return errors.New("Just the types A (ASCII) and I (binary) are supported.")
+	}
+
+	functions["VERIFY"] = func(connection *ftps.ServerConn, parameters ...string) error {
+		if len(parameters) != 1 {
+			return errors.New("Please use VERIFY-command in the following pattern \"VERIFY SHA-256|SHA-1|MD5|CRC32|OFF\".")
+		}
+		if strings.ToUpper(parameters[0]) == "OFF" {
+			return connection.SetTransferVerification("")
+		}
+		return connection.SetTransferVerification(ftps_qftp_client.HashAlgorithm(strings.ToUpper(parameters[0])))
+	}
+
 	return functions
 }
+
+// Asks the user a yes/no question, the default is no.
+func confirm(question string) bool {
+	fmt.Print("  " + question + " [y/N] ")
+	line, _, err := consoleReader.ReadLine()
+	if err != nil {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(string(line)))
+	return answer == "y" || answer == "yes"
+}
+
+// Draws a progress bar of a transfer or of a job with multiple files.
+func printProgress(progress ftps_qftp_client.Progress) {
+	name := progress.Path
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	done, total, rate, eta := progress.Done, progress.Total, progress.Rate, progress.ETA
+	finished := progress.Finished
+	if progress.Job != nil {
+		name = strconv.Itoa(progress.Job.Finished) + "/" + strconv.Itoa(progress.Job.Files) + " files"
+		done, total, rate, eta = progress.Job.Done, progress.Job.Total, progress.Job.Rate, progress.Job.ETA
+		finished = progress.Job.Finished == progress.Job.Files
+	}
+
+	const width = 30
+	bar := ""
+	if total > 0 {
+		filled := int(done * width / total)
+		if filled > width {
+			filled = width
+		}
+		bar = "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "] " +
+			fmt.Sprintf("%3d%% ", done*100/total)
+	}
+	line := fmt.Sprintf("\r  %-20.20s %s%s %s/s", name, bar, formatBytes(float64(done)), formatBytes(rate))
+	if eta >= 0 && !finished {
+		line = line + fmt.Sprintf(" ETA %d:%02d", int(eta.Minutes()), int(eta.Seconds())%60)
+	}
+	// Overwrite the rest of a longer previous line
+	fmt.Printf("%-100s", line)
+	if finished {
+		fmt.Println()
+	}
+}
+
+// Formats a number of bytes with a binary unit.
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
+
+// Prints an entry of a directory listing in a format similar to "ls -l".
+func printEntry(entry *ftps_qftp_client.Entry) {
+	var typeChar string
+	switch entry.Type {
+	case ftps_qftp_client.EntryTypeFile:
+		typeChar = "-"
+	case ftps_qftp_client.EntryTypeFolder:
+		typeChar = "d"
+	case ftps_qftp_client.EntryTypeLink:
+		typeChar = "l"
+	default:
+		typeChar = "?"
+	}
+	fmt.Printf("  %s %12d %20s %s\n", typeChar, entry.Size, entry.Time.String(), entry.Name)
+}
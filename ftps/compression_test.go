@@ -0,0 +1,64 @@
+package ftps
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21225"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.EnableCompression(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.Retr("welcome.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(data) != "welcome" {
+		t.Errorf("unexpected data: %q", data)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	content := strings.Repeat("date;value\n", 1000)
+	err = c.Stor("report.csv", strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	if string(mock.stored) != content {
+		t.Error("stored data differs")
+	}
+
+	expected := []string{"FEAT", "MODE", "OPTS", "PASV", "RETR", "PASV", "STOR", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
@@ -0,0 +1,98 @@
+// Contains the helpers to interrupt blocking operations when their
+// context is done.
+
+package ftps
+
+import (
+	"context"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// A deadline in the past, which lets blocked reads and writes return immediately.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// watchContext calls interrupt, if ctx is done before the returned stop
+// function is called. stop waits until the watching goroutine has ended,
+// it may be called more than once.
+func watchContext(ctx context.Context, interrupt func()) (stop func()) {
+	if ctx.Done() == nil {
+		// The context can never be done
+		return func() {}
+	}
+
+	stopped := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-ctx.Done():
+			interrupt()
+		case <-stopped:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopped)
+			<-finished
+		})
+	}
+}
+
+// withContext runs f, which reads from the control connection, and
+// interrupts the read when ctx is done. If f failed because of the
+// interruption, the error of ctx is returned.
+// Writes are not interrupted, because an interrupted write leaves a part of a
+// TLS record on the connection, after which the TLS connection can not be
+// used anymore. Commands are short, so their writes do not block.
+func (c *ServerConn) withContext(ctx context.Context, f func() error) error {
+	stop := watchContext(ctx, func() {
+		c.tcpconn.SetReadDeadline(aLongTimeAgo)
+	})
+	err := f()
+	stop()
+
+	if ctx.Err() != nil {
+		// Make the control connection usable for the next command
+		c.tcpconn.SetReadDeadline(time.Time{})
+		if _, isProtocolError := err.(*textproto.Error); err != nil && !isProtocolError {
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// readResponse reads the reply to the last command from the control connection.
+// If ctx is done before the final reply is read, the reply is left pending and
+// will be read before the next command.
+func (c *ServerConn) readResponse(ctx context.Context, expected int) (code int, message string, err error) {
+	err = c.withContext(ctx, func() error {
+		var readErr error
+		code, message, readErr = c.conn.ReadResponse(expected)
+		return readErr
+	})
+	if err != nil && err == ctx.Err() {
+		c.pendingReplies++
+	}
+	return
+}
+
+// readPendingReplies reads the final replies of the commands which were
+// interrupted, so that the next reply read belongs to the next command.
+func (c *ServerConn) readPendingReplies(ctx context.Context) error {
+	return c.withContext(ctx, func() error {
+		for c.pendingReplies > 0 {
+			code, _, err := c.conn.ReadResponse(-1)
+			if err != nil {
+				return err
+			}
+			// Preliminary replies (1xx) are followed by the final one
+			if code >= 200 {
+				c.pendingReplies--
+			}
+		}
+		return nil
+	})
+}
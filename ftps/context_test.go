@@ -0,0 +1,91 @@
+package ftps
+
+import (
+	"context"
+	"crypto/tls"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestContextInterruptsCommand(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21214"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = c.ChangeDirContext(ctx, "incoming")
+	if err != context.DeadlineExceeded {
+		t.Errorf("ChangeDirContext returned err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The late reply to CWD must not be taken as reply to NOOP
+	err = c.NoOp()
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	expected := []string{"FEAT", "CWD", "NOOP", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
+
+func TestContextInterruptsTLSCommand(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	certificate, certfile := generateTestCertificate(t, t.TempDir())
+	address := "127.0.0.1:21262"
+	mock := newFtpMockTLS(t, address, &tls.Config{Certificates: []tls.Certificate{certificate}})
+	defer mock.Close()
+
+	c, err := DialWithConfig(address, DialConfig{Timeout: 5 * time.Second, TLS: caFile(certfile), Implicit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = c.ChangeDirContext(ctx, "incoming")
+	if err != context.DeadlineExceeded {
+		t.Errorf("ChangeDirContext returned err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// A done context does not send the command
+	err = c.NoOpContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("NoOpContext returned err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The TLS connection is usable after the interrupted read
+	err = c.NoOp()
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	expected := []string{"FEAT", "CWD", "NOOP", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
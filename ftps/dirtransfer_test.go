@@ -0,0 +1,187 @@
+package ftps
+
+import (
+	"errors"
+	"github.com/attenberger/ftps_qftp-client"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestDownloadDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	dir, err := ioutil.TempDir("", "ftps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	address := "127.0.0.1:21253"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.DownloadDir("tree", filepath.Join(dir, "local"), ftps_qftp_client.DirTransferOptions{Parallel: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connections to close
+	mock.Wait()
+
+	for _, name := range []string{"a.txt", filepath.Join("sub", "b.txt")} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "local", name))
+		if err != nil {
+			t.Error(err)
+		} else if string(data) != "welcome" {
+			t.Errorf("unexpected content of %s: %q", name, data)
+		}
+	}
+	// Links are skipped
+	if _, err := os.Lstat(filepath.Join(dir, "local", "link")); !os.IsNotExist(err) {
+		t.Error("link was downloaded")
+	}
+}
+
+func TestUploadDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows.")
+	}
+
+	dir, err := ioutil.TempDir("", "ftps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"flink": "a.txt", "dlink": "sub", "sub/up": ".."} {
+		err = os.Symlink(target, filepath.Join(dir, filepath.FromSlash(link)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	address := "127.0.0.1:21254"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.MakeDirAll("/upload/skip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The existing directories are no error
+	err = c.UploadDir(dir, "/upload/skip", ftps_qftp_client.DirTransferOptions{Parallel: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.UploadDir(dir, "/upload/follow", ftps_qftp_client.DirTransferOptions{Parallel: 2, Symlinks: ftps_qftp_client.FollowSymlinks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connections to close
+	mock.Wait()
+
+	expected := map[string][]byte{
+		"/upload/skip/a.txt":         []byte("a"),
+		"/upload/skip/sub/b.txt":     []byte("b"),
+		"/upload/follow/a.txt":       []byte("a"),
+		"/upload/follow/flink":       []byte("a"),
+		"/upload/follow/sub/b.txt":   []byte("b"),
+		"/upload/follow/dlink/b.txt": []byte("b"),
+	}
+	if !reflect.DeepEqual(mock.files, expected) {
+		t.Errorf("unexpected stored files: %q", mock.files)
+	}
+	for _, dir := range []string{"/upload", "/upload/skip/sub", "/upload/follow/dlink"} {
+		if !mock.dirs[dir] {
+			t.Errorf("directory %s was not created", dir)
+		}
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	address := "127.0.0.1:21255"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file is deleted without a listing
+	err = c.RemoveAll("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.RemoveAllParallel("tree", 2)
+	removeErr, ok := err.(*ftps_qftp_client.RemoveAllError)
+	if !ok {
+		t.Fatalf("expected RemoveAllError, got %v", err)
+	}
+	if !reflect.DeepEqual(removeErr.Paths, []string{"tree/sub/b.txt"}) {
+		t.Errorf("unexpected failed paths: %q", removeErr.Paths)
+	}
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) || protoErr.Code != StatusFileUnavailable {
+		t.Errorf("expected the reply of the server, got %v", err)
+	}
+
+	c.Quit()
+
+	// Wait for the connections to close
+	mock.Wait()
+
+	// The directories are removed after their content
+	expected := []string{"file.txt", "tree/a.txt", "tree/link", "tree/sub", "tree"}
+	// The files are deleted in parallel
+	sort.Strings(mock.removed[1:3])
+	if !reflect.DeepEqual(mock.removed, expected) {
+		t.Errorf("unexpected removed paths: %q", mock.removed)
+	}
+}
@@ -3,14 +3,20 @@ package ftps
 
 import (
 	"bufio"
+	"compress/zlib"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/attenberger/ftps_qftp-client"
+	"hash"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/textproto"
+	"os"
+	pathpkg "path"
 	"strconv"
 	"strings"
 	"time"
@@ -21,21 +27,97 @@ type ServerConn struct {
 	conn                        *textproto.Conn
 	tcpconn                     net.Conn
 	tlsConfig                   *tls.Config
+	tlsControlConn              *tls.Conn // nil, if the control connection is not secured
 	tlsSecuredControlConnection bool
 	tlsSecuredDataConnection    bool
+	tlsNegotiated               bool // TLS was negotiated, also if the control connection was cleared later
+	authTLSOptions              AuthTLSOptions
 	hostname                    string
 	hostcontrolport             string
 	username                    string
 	password                    string
-	certfilename                string
+	tlsOptions                  ftps_qftp_client.TLSOptions
 	timeout                     time.Duration
+	implicitTLS                 bool
 	features                    map[string]string
+	transferType                ftps_qftp_client.TransferType
+	compression                 bool // MODE Z
+	compressionLevel            int
+	hashAlgorithm               ftps_qftp_client.HashAlgorithm // selected with OPTS HASH
+	verifyAlgorithm             ftps_qftp_client.HashAlgorithm // for the verification of transfers
+	pendingReplies              int                            // replies of interrupted commands, which are still to read
+	progressFunc                ftps_qftp_client.ProgressFunc  // reports the progress of the transfers, nil if not reported
+	activeMode                  *ActiveModeConfig              // nil in passive mode
+}
+
+// DialConfig configures the connection to the FTP server.
+type DialConfig struct {
+	Timeout  time.Duration               // timeout for dialing and the data connections, 0 for no timeout
+	TLS      ftps_qftp_client.TLSOptions // verification of the server certificate
+	Implicit bool                        // implicit FTPS, TLS is negotiated before the greeting of the server
+	// Protection level and CCC for implicit FTPS, see AuthTLSWithOptions
+	ImplicitTLS AuthTLSOptions
+}
+
+// ProtectionLevel of the data connections, set with PROT (RFC 4217).
+type ProtectionLevel byte
+
+// The supported protection levels
+const (
+	ProtectionPrivate ProtectionLevel = 'P' // data connections are secured with TLS
+	ProtectionClear   ProtectionLevel = 'C' // data connections are not secured
+)
+
+// AuthTLSOptions configures the security of a session after the TLS
+// negotiation.
+type AuthTLSOptions struct {
+	Protection ProtectionLevel // of the data connections, ProtectionPrivate if not set
+	// ClearCommandChannel sends CCC after login, so the control connection
+	// is cleartext afterwards. NAT firewalls can inspect the PASV replies
+	// then, the password was sent secured.
+	ClearCommandChannel bool
+}
+
+// ActiveModeConfig configures active mode, where the client listens for the
+// data connections and announces the address with PORT or EPRT.
+type ActiveModeConfig struct {
+	ExternalIP string // IP address announced to the server, the local address of the control connection if empty
+	PortMin    int    // lowest local port to listen on, 0 for any port
+	PortMax    int    // highest local port to listen on
 }
 
 // response represent a data-connection
 type response struct {
 	conn net.Conn
 	c    *ServerConn
+	ctx  context.Context
+	stop func()    // stops watching ctx for the data connection
+	eof  bool      // whether the transfer is complete
+	data io.Reader // reads conn, converted in ASCII mode
+	hash hash.Hash // checksum of the read data for the verification, nil if not verified
+	path string
+
+	progress *ftps_qftp_client.ProgressReader // reports the progress, nil if not reported
+}
+
+// Telnet commands to interrupt a transfer, see RFC 854
+const (
+	telnetIAC = 255 // interpret as command
+	telnetIP  = 244 // interrupt process
+	telnetDM  = 242 // data mark, ends the Synch
+)
+
+// newResponse creates a response for the data connection, which is
+// interrupted when ctx is done.
+func (c *ServerConn) newResponse(ctx context.Context, conn net.Conn) *response {
+	stop := watchContext(ctx, func() {
+		conn.SetDeadline(aLongTimeAgo)
+	})
+	r := &response{conn: conn, c: c, ctx: ctx, stop: stop, data: conn}
+	if c.compression {
+		r.data = ftps_qftp_client.NewModeZReader(conn)
+	}
+	return r
 }
 
 // Connect is an alias to Dial, for backward compatibility
@@ -49,10 +131,27 @@ func Dial(addr string, certfile string) (*ServerConn, error) {
 }
 
 // DialTimeout initializes the connection to the specified ftp server address.
+// The certificate of the server is verified with the CAs or the self-signed
+// certificate in certfile, or with the system roots if certfile is empty.
 //
 // It is generally followed by a call to Login() as most FTP commands require
 // an authenticated user.
 func DialTimeout(addr string, timeout time.Duration, certfile string) (*ServerConn, error) {
+	config := DialConfig{Timeout: timeout}
+	if certfile != "" {
+		config.TLS = ftps_qftp_client.TLSOptions{Trust: ftps_qftp_client.TrustCAFile, CAFile: certfile}
+	}
+	return DialWithConfig(addr, config)
+}
+
+// DialWithConfig initializes the connection to the specified ftp server address
+// with the given configuration.
+//
+// With implicit FTPS the control connection is secured with TLS before the
+// greeting of the server and the data connections are protected without an
+// AUTH TLS command. The servers usually listen on port 990 for it.
+func DialWithConfig(addr string, config DialConfig) (*ServerConn, error) {
+	timeout := config.Timeout
 	tconn, err := net.DialTimeout("tcp", addr, timeout)
 	if err != nil {
 		return nil, err
@@ -67,26 +166,41 @@ func DialTimeout(addr string, timeout time.Duration, certfile string) (*ServerCo
 		return nil, err
 	}
 
-	var tlsConfig tls.Config
 	conn := textproto.NewConn(tconn)
-	if certfile != "" {
-		tlsConfig, err = generateTLSConfig(certfile)
-		if err != nil {
-			return nil, err
-		}
+	tlsConfig, err := ftps_qftp_client.NewTLSConfig(addr, config.TLS)
+	if err != nil {
+		tconn.Close()
+		return nil, err
 	}
+	// The data connections resume the TLS session of the control connection,
+	// many servers require this (e.g. vsftpd with require_ssl_reuse).
+	// The sessions are cached by the server name, which must not differ
+	// between the connections.
+	tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
 
 	c := &ServerConn{
 		conn:            conn,
 		tcpconn:         tconn,
-		tlsConfig:       &tlsConfig,
+		tlsConfig:       tlsConfig,
 		hostname:        addr,
 		hostcontrolport: port,
-		certfilename:    certfile,
+		tlsOptions:      config.TLS,
 		timeout:         timeout,
+		transferType:    ftps_qftp_client.TransferTypeBinary,
+		implicitTLS:     config.Implicit,
+		authTLSOptions:  config.ImplicitTLS,
 		features:        make(map[string]string),
 	}
 
+	if config.Implicit {
+		err = c.handshakeTLS()
+		if err != nil {
+			tconn.Close()
+			return nil, handshakeError(err)
+		}
+		c.tlsSecuredDataConnection = true
+	}
+
 	_, _, err = c.conn.ReadResponse(StatusReady)
 	if err != nil {
 		c.Quit()
@@ -102,56 +216,162 @@ func DialTimeout(addr string, timeout time.Duration, certfile string) (*ServerCo
 	return c, nil
 }
 
-// Generates from the specified certifiate file a tls configuration
-func generateTLSConfig(certfile string) (tls.Config, error) {
-	tlsConfig := tls.Config{}
-	tlsConfig.InsecureSkipVerify = true
-	certficate, err := ioutil.ReadFile(certfile)
-	if err != nil {
-		return tlsConfig, err
-	}
-	rootCAs := x509.NewCertPool()
-	if !rootCAs.AppendCertsFromPEM([]byte(certficate)) {
-		return tlsConfig, errors.New("ERROR: Fehler beim parsen des Serverzertifikats.\n")
+// handshakeError describes a failed TLS handshake. A rejected certificate of
+// the server is returned as *ftps_qftp_client.CertificateError.
+func handshakeError(err error) error {
+	if _, ok := err.(*ftps_qftp_client.CertificateError); ok {
+		return err
 	}
-	return tlsConfig, nil
+	return errors.New("Error while TLS handshake. " + err.Error())
 }
 
 // Negotiates TLS for the connection
 func (c *ServerConn) AuthTLS() error {
+	return c.AuthTLSContext(context.Background())
+}
+
+// AuthTLSContext is like AuthTLS but with a context.
+func (c *ServerConn) AuthTLSContext(ctx context.Context) error {
+	return c.AuthTLSWithOptionsContext(ctx, AuthTLSOptions{})
+}
+
+// AuthTLSWithOptions negotiates TLS for the connection like AuthTLS.
+// The protection level of the data connections is set with the options and
+// the control connection is cleared after login, if requested.
+func (c *ServerConn) AuthTLSWithOptions(options AuthTLSOptions) error {
+	return c.AuthTLSWithOptionsContext(context.Background(), options)
+}
+
+// AuthTLSWithOptionsContext is like AuthTLSWithOptions but with a context.
+func (c *ServerConn) AuthTLSWithOptionsContext(ctx context.Context, options AuthTLSOptions) error {
 	if c.tlsConfig == nil {
 		return errors.New("TLS-configuration ist missing.")
 	}
+	if c.tlsSecuredControlConnection {
+		return errors.New("Connection is already secured with TLS.")
+	}
 
 	// Secure control connection
-	_, _, err := c.cmd(StatusAuthTLS, "AUTH TLS")
+	_, _, err := c.cmdContext(ctx, StatusAuthTLS, "AUTH TLS")
 	if err != nil {
 		return errors.New("Error while AUTH TLS command. " + err.Error())
 	}
-	c.conn = textproto.NewConn(tls.Client(c.tcpconn, c.tlsConfig))
+	tlsConn := tls.Client(c.tcpconn, c.tlsConfig)
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		return handshakeError(err)
+	}
+	c.secureControlConnection(tlsConn)
+	c.authTLSOptions = options
+
+	return c.protectDataConnection(ctx)
+}
+
+// handshakeTLS secures the control connection with TLS before the greeting
+// of the server for implicit FTPS.
+func (c *ServerConn) handshakeTLS() error {
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	tlsConn := tls.Client(c.tcpconn, c.tlsConfig)
+	err := tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		return err
+	}
+	c.secureControlConnection(tlsConn)
+	return nil
+}
+
+// secureControlConnection switches the control connection to TLS
+func (c *ServerConn) secureControlConnection(tlsConn *tls.Conn) {
+	c.conn = textproto.NewConn(tlsConn)
+	c.tlsControlConn = tlsConn
 	c.tlsSecuredControlConnection = true
+	c.tlsNegotiated = true
+}
 
-	// Secure data connection
-	_, _, err = c.cmd(StatusCommandOK, "PBSZ 0")
+// protectDataConnection sets the protection level of the data connections
+// with PBSZ and PROT, as described in RFC 4217.
+func (c *ServerConn) protectDataConnection(ctx context.Context) error {
+	_, _, err := c.cmdContext(ctx, StatusCommandOK, "PBSZ 0")
 	if err != nil {
 		return errors.New("Error while PBSZ 0 command. " + err.Error())
 	}
 
-	_, _, err = c.cmd(StatusCommandOK, "PROT P")
+	level := c.authTLSOptions.Protection
+	if level == 0 {
+		level = ProtectionPrivate
+	}
+	_, _, err = c.cmdContext(ctx, StatusCommandOK, "PROT %c", level)
 	if err != nil {
-		return errors.New("Error while PBSZ 0 command. " + err.Error())
+		return errors.New("Error while PROT " + string(level) + " command. " + err.Error())
 	}
-	c.tlsSecuredDataConnection = true
+	c.tlsSecuredDataConnection = level == ProtectionPrivate
 
 	return nil
 }
 
+// ClearCommandChannel issues a CCC FTP command and continues the control
+// connection in cleartext, the data connections keep their protection level.
+// CCC is described in RFC 4217.
+func (c *ServerConn) ClearCommandChannel() error {
+	return c.ClearCommandChannelContext(context.Background())
+}
+
+// ClearCommandChannelContext is like ClearCommandChannel but with a context.
+func (c *ServerConn) ClearCommandChannelContext(ctx context.Context) error {
+	if !c.tlsSecuredControlConnection {
+		return errors.New("Control connection is not secured with TLS.")
+	}
+
+	_, _, err := c.cmdContext(ctx, StatusCommandOK, "CCC")
+	if err != nil {
+		return errors.New("Error while CCC command. " + err.Error())
+	}
+
+	// Close TLS with close_notify in both directions without closing the
+	// TCP connection
+	err = c.tlsControlConn.CloseWrite()
+	if err != nil {
+		return err
+	}
+	if c.timeout > 0 {
+		c.tcpconn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	stop := watchContext(ctx, func() {
+		c.tcpconn.SetReadDeadline(aLongTimeAgo)
+	})
+	_, err = io.Copy(ioutil.Discard, c.tlsControlConn)
+	stop()
+	// CloseWrite also sets the write deadline
+	c.tcpconn.SetDeadline(time.Time{})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errors.New("Error while closing TLS of the control connection. " + err.Error())
+	}
+
+	c.conn = textproto.NewConn(c.tcpconn)
+	c.tlsControlConn = nil
+	c.tlsSecuredControlConnection = false
+	return nil
+}
+
 // Login authenticates the client with specified user and password.
 //
 // "anonymous"/"anonymous" is a common user/password scheme for FTP servers
 // that allows anonymous read-only accounts.
 func (c *ServerConn) Login(user, password string) error {
-	code, message, err := c.cmd(-1, "USER %s", user)
+	return c.LoginContext(context.Background(), user, password)
+}
+
+// LoginContext is like Login but with a context.
+func (c *ServerConn) LoginContext(ctx context.Context, user, password string) error {
+	code, message, err := c.cmdContext(ctx, -1, "USER %s", user)
 	if err != nil {
 		return err
 	}
@@ -159,7 +379,7 @@ func (c *ServerConn) Login(user, password string) error {
 	switch code {
 	case StatusLoggedIn:
 	case StatusUserOK:
-		_, _, err = c.cmd(StatusLoggedIn, "PASS %s", password)
+		_, _, err = c.cmdContext(ctx, StatusLoggedIn, "PASS %s", password)
 		if err != nil {
 			return err
 		}
@@ -170,14 +390,30 @@ func (c *ServerConn) Login(user, password string) error {
 	c.username = user
 	c.password = password
 
-	// Switch to binary mode
-	_, _, err = c.cmd(StatusCommandOK, "TYPE I")
+	// With implicit FTPS the data connections are protected by default,
+	// but many servers expect PBSZ and PROT anyway
+	if c.implicitTLS {
+		err = c.protectDataConnection(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.authTLSOptions.ClearCommandChannel && c.tlsSecuredControlConnection {
+		err = c.ClearCommandChannelContext(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Binary mode, if no other type was set
+	_, _, err = c.cmdContext(ctx, StatusCommandOK, "TYPE %c", c.transferType)
 	if err != nil {
 		return err
 	}
 
 	// logged, check features again
-	if err = c.Feat(); err != nil {
+	if err = c.FeatContext(ctx); err != nil {
 		c.Quit()
 		return err
 	}
@@ -189,7 +425,12 @@ func (c *ServerConn) Login(user, password string) error {
 // the remote FTP server.
 // FEAT is described in RFC 2389
 func (c *ServerConn) Feat() error {
-	code, message, err := c.cmd(-1, "FEAT")
+	return c.FeatContext(context.Background())
+}
+
+// FeatContext is like Feat but with a context.
+func (c *ServerConn) FeatContext(ctx context.Context) error {
+	code, message, err := c.cmdContext(ctx, -1, "FEAT")
 	if err != nil {
 		return err
 	}
@@ -228,8 +469,8 @@ func (c *ServerConn) Features() map[string]string {
 }
 
 // epsv issues an "EPSV" command to get a port number for a data connection.
-func (c *ServerConn) epsv() (port int, err error) {
-	_, line, err := c.cmd(StatusExtendedPassiveMode, "EPSV")
+func (c *ServerConn) epsv(ctx context.Context) (port int, err error) {
+	_, line, err := c.cmdContext(ctx, StatusExtendedPassiveMode, "EPSV")
 	if err != nil {
 		return
 	}
@@ -245,8 +486,8 @@ func (c *ServerConn) epsv() (port int, err error) {
 }
 
 // pasv issues a "PASV" command to get a port number for a data connection.
-func (c *ServerConn) pasv() (port int, err error) {
-	_, line, err := c.cmd(StatusPassiveMode, "PASV")
+func (c *ServerConn) pasv(ctx context.Context) (port int, err error) {
+	_, line, err := c.cmdContext(ctx, StatusPassiveMode, "PASV")
 	if err != nil {
 		return
 	}
@@ -280,7 +521,7 @@ func (c *ServerConn) pasv() (port int, err error) {
 }
 
 // openDataConn creates a new FTP data connection.
-func (c *ServerConn) openDataConn() (net.Conn, error) {
+func (c *ServerConn) openDataConn(ctx context.Context) (net.Conn, error) {
 	var port int
 	var err error
 
@@ -290,10 +531,10 @@ func (c *ServerConn) openDataConn() (net.Conn, error) {
 	_, epsvSupported := c.features["EPSV"]
 
 	if !nat6Supported && !epsvSupported {
-		port, _ = c.pasv()
+		port, _ = c.pasv(ctx)
 	}
 	if port == 0 {
-		port, err = c.epsv()
+		port, err = c.epsv(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -301,17 +542,126 @@ func (c *ServerConn) openDataConn() (net.Conn, error) {
 
 	// Build the new net address string
 	addr := net.JoinHostPort(c.hostname, strconv.Itoa(port))
-	conn, err := net.DialTimeout("tcp", addr, c.timeout)
+	dialer := &net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return conn, err
 	}
-	if c.tlsSecuredDataConnection {
-		conn = tls.Client(conn, c.tlsConfig)
-		if conn == nil {
-			return conn, errors.New("Error while seting up tls for the connection.")
+	return c.secureDataConn(conn), nil
+}
+
+// SetActiveMode switches to active mode, the server will connect to the
+// client for data connections.
+func (c *ServerConn) SetActiveMode(config ActiveModeConfig) {
+	c.activeMode = &config
+}
+
+// SetPassiveMode switches to passive mode, the client will connect to the
+// server for data connections. This is the default.
+func (c *ServerConn) SetPassiveMode() {
+	c.activeMode = nil
+}
+
+// listenDataConn listens for a new FTP data connection in active mode and
+// announces the address to the server with a PORT or EPRT command.
+// EPRT is described in RFC 2428.
+func (c *ServerConn) listenDataConn(ctx context.Context) (net.Listener, error) {
+	localIP := c.tcpconn.LocalAddr().(*net.TCPAddr).IP
+	listener, err := listenPortRange(localIP, c.activeMode.PortMin, c.activeMode.PortMax)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := localIP
+	if c.activeMode.ExternalIP != "" {
+		ip = net.ParseIP(c.activeMode.ExternalIP)
+		if ip == nil {
+			listener.Close()
+			return nil, errors.New("Invalid external IP address " + c.activeMode.ExternalIP + ".")
+		}
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if ip.To4() != nil {
+		_, _, err = c.cmdContext(ctx, StatusCommandOK, "PORT %s", formatPortAddress(ip, port))
+	} else {
+		_, _, err = c.cmdContext(ctx, StatusCommandOK, "EPRT %s", formatEprtAddress(ip, port))
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// listenPortRange listens on the first free port between portMin and portMax.
+func listenPortRange(ip net.IP, portMin int, portMax int) (net.Listener, error) {
+	if portMax < portMin {
+		portMax = portMin
+	}
+
+	var err error
+	for port := portMin; port <= portMax; port++ {
+		var listener net.Listener
+		listener, err = net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+		if err == nil {
+			return listener, nil
 		}
 	}
-	return conn, nil
+	return nil, errors.New("No free port for the data connection. " + err.Error())
+}
+
+// formatPortAddress formats the argument of the PORT command:
+// h1,h2,h3,h4,p1,p2
+func formatPortAddress(ip net.IP, port int) string {
+	ip4 := ip.To4()
+	return fmt.Sprintf("%d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port/256, port%256)
+}
+
+// formatEprtAddress formats the argument of the EPRT command:
+// |1|132.235.1.2|6275| or |2|1080::8:800:200C:417A|5282|
+func formatEprtAddress(ip net.IP, port int) string {
+	protocol := 2
+	if ip.To4() != nil {
+		protocol = 1
+	}
+	return fmt.Sprintf("|%d|%s|%d|", protocol, ip.String(), port)
+}
+
+// acceptDataConn accepts the FTP data connection of the server in active mode.
+func (c *ServerConn) acceptDataConn(ctx context.Context, listener net.Listener) (net.Conn, error) {
+	if c.timeout > 0 {
+		listener.(*net.TCPListener).SetDeadline(time.Now().Add(c.timeout))
+	}
+	stop := watchContext(ctx, func() {
+		listener.Close()
+	})
+	conn, err := listener.Accept()
+	stop()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	// Only the server is allowed to connect
+	serverIP := c.tcpconn.RemoteAddr().(*net.TCPAddr).IP
+	if !conn.RemoteAddr().(*net.TCPAddr).IP.Equal(serverIP) {
+		conn.Close()
+		return nil, errors.New("Data connection from " + conn.RemoteAddr().String() + " is not from the server.")
+	}
+	return c.secureDataConn(conn), nil
+}
+
+// secureDataConn wraps the data connection in TLS, if the data connection is
+// protected (PROT P). The client is always the TLS client, also in active mode
+// where the server opened the TCP connection (RFC 4217).
+func (c *ServerConn) secureDataConn(conn net.Conn) net.Conn {
+	if !c.tlsSecuredDataConnection {
+		return conn
+	}
+	return tls.Client(conn, c.tlsConfig)
 }
 
 // Exec runs a command and check for expected code
@@ -322,46 +672,144 @@ func (c *ServerConn) Exec(expected int, format string, args ...interface{}) (int
 // cmd is a helper function to execute a command and check for the expected FTP
 // return code
 func (c *ServerConn) cmd(expected int, format string, args ...interface{}) (int, string, error) {
-	_, err := c.conn.Cmd(format, args...)
+	return c.cmdContext(context.Background(), expected, format, args...)
+}
+
+// cmdContext is like cmd but interrupts the command when ctx is done.
+func (c *ServerConn) cmdContext(ctx context.Context, expected int, format string, args ...interface{}) (int, string, error) {
+	err := c.sendCmd(ctx, format, args...)
 	if err != nil {
 		return 0, "", err
 	}
 
-	return c.conn.ReadResponse(expected)
+	return c.readResponse(ctx, expected)
+}
+
+// sendCmd sends a command on the control connection after the pending
+// replies of interrupted commands were read. It is not sent, if ctx is done.
+func (c *ServerConn) sendCmd(ctx context.Context, format string, args ...interface{}) error {
+	err := c.readPendingReplies(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	// The write is not interrupted, see withContext
+	_, err = c.conn.Cmd(format, args...)
+	return err
 }
 
 // cmdDataConnFrom executes a command which require a FTP data connection.
 // Issues a REST FTP command to specify the number of bytes to skip for the transfer.
-func (c *ServerConn) cmdDataConnFrom(offset uint64, format string, args ...interface{}) (net.Conn, error) {
-	conn, err := c.openDataConn()
+// It returns the data connection and the message of the preliminary reply.
+func (c *ServerConn) cmdDataConnFrom(ctx context.Context, offset uint64, format string, args ...interface{}) (net.Conn, string, error) {
+	if c.activeMode != nil {
+		listener, err := c.listenDataConn(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		defer listener.Close()
+
+		msg, err := c.startTransfer(ctx, offset, format, args...)
+		if err != nil {
+			return nil, "", err
+		}
+
+		conn, err := c.acceptDataConn(ctx, listener)
+		if err != nil {
+			// The reply to the transfer command is read before the next command
+			c.pendingReplies++
+			return nil, "", err
+		}
+		return conn, msg, nil
+	}
+
+	conn, err := c.openDataConn(ctx)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
+	msg, err := c.startTransfer(ctx, offset, format, args...)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+
+	return conn, msg, nil
+}
+
+// restartError is returned by RetrFrom and StorFrom, when the server does not
+// accept the REST command.
+type restartError struct {
+	err *textproto.Error
+}
+
+func (e *restartError) Error() string {
+	return "The server did not accept the offset of the transfer. " + e.err.Error()
+}
+
+func (e *restartError) Unwrap() error {
+	return e.err
+}
+
+// startTransfer sends a command which require a FTP data connection and checks
+// that the server opens the data connection.
+// Issues a REST FTP command to specify the number of bytes to skip for the transfer.
+func (c *ServerConn) startTransfer(ctx context.Context, offset uint64, format string, args ...interface{}) (string, error) {
 	if offset != 0 {
-		_, _, err := c.cmd(StatusRequestFilePending, "REST %d", offset)
-		if err != nil {
-			return nil, err
+		_, _, err := c.cmdContext(ctx, StatusRequestFilePending, "REST %d", offset)
+		if protoErr, ok := err.(*textproto.Error); ok {
+			return "", &restartError{protoErr}
+		} else if err != nil {
+			return "", err
 		}
 	}
 
-	_, err = c.conn.Cmd(format, args...)
+	err := c.sendCmd(ctx, format, args...)
 	if err != nil {
-		conn.Close()
-		return nil, err
+		return "", err
 	}
 
-	code, msg, err := c.conn.ReadResponse(-1)
+	code, msg, err := c.readResponse(ctx, -1)
 	if err != nil {
-		conn.Close()
-		return nil, err
+		return "", err
 	}
 	if code != StatusAlreadyOpen && code != StatusAboutToSend {
-		conn.Close()
-		return nil, &textproto.Error{Code: code, Msg: msg}
+		return "", &textproto.Error{Code: code, Msg: msg}
+	}
+	return msg, nil
+}
+
+// abort issues an ABOR FTP command to abort the transfer running on the data
+// connection. Afterwards the data connection is closed and the reply to the
+// transfer command (426 or 226) and to ABOR are read.
+func (c *ServerConn) abort(ctx context.Context, conn net.Conn) error {
+	var err error
+	if c.tlsSecuredControlConnection {
+		// Telnet signals can not be sent through TLS
+		_, err = c.conn.Cmd("ABOR")
+	} else {
+		// Telnet IP and Synch let the server interrupt the transfer, the
+		// Synch is an urgent IAC followed by DM.
+		err = sendUrgent(c.tcpconn, []byte{telnetIAC, telnetIP, telnetIAC})
+		if err == nil {
+			c.conn.W.WriteByte(telnetDM)
+			err = c.conn.PrintfLine("ABOR")
+		}
+	}
+	conn.Close()
+
+	// The reply to the transfer command
+	c.pendingReplies++
+	if err != nil {
+		return err
 	}
+	// The reply to ABOR
+	c.pendingReplies++
 
-	return conn, nil
+	return c.readPendingReplies(ctx)
 }
 
 var errUnsupportedListLine = errors.New("Unsupported LIST line")
@@ -385,25 +833,8 @@ func parseRFC3659ListLine(line string) (*ftps_qftp_client.Entry, error) {
 			return nil, errUnsupportedListLine
 		}
 
-		key := field[:i]
-		value := field[i+1:]
-
-		switch key {
-		case "modify":
-			var err error
-			e.Time, err = time.Parse("20060102150405", value)
-			if err != nil {
-				return nil, err
-			}
-		case "type":
-			switch value {
-			case "dir", "cdir", "pdir":
-				e.Type = ftps_qftp_client.EntryTypeFolder
-			case "file":
-				e.Type = ftps_qftp_client.EntryTypeFile
-			}
-		case "size":
-			e.SetSize(value)
+		if err := e.SetFact(field[:i], field[i+1:]); err != nil {
+			return nil, err
 		}
 	}
 	return e, nil
@@ -519,6 +950,25 @@ var listLineParsers = []func(line string) (*ftps_qftp_client.Entry, error){
 	parseDirListLine,
 }
 
+// parseUniqueName parses the name of the file stored by STOU from a reply,
+// e.g. "FILE: name" (RFC 1123) or "Transfer complete (unique file name:name)."
+// It returns an empty string, if the reply contains no name.
+func parseUniqueName(msg string) string {
+	for _, line := range strings.Split(msg, "\n") {
+		if i := strings.Index(strings.ToUpper(line), "FILE:"); i >= 0 {
+			return strings.TrimSpace(line[i+len("FILE:"):])
+		}
+		if i := strings.Index(strings.ToLower(line), "unique file name"); i >= 0 {
+			name := strings.TrimLeft(line[i+len("unique file name"):], ": ")
+			if j := strings.LastIndex(name, ")"); j >= 0 {
+				name = name[:j]
+			}
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
 // parseListLine parses the various non-standard format returned by the LIST
 // FTP command.
 func parseListLine(line string) (*ftps_qftp_client.Entry, error) {
@@ -535,12 +985,17 @@ func parseListLine(line string) (*ftps_qftp_client.Entry, error) {
 
 // NameList issues an NLST FTP command.
 func (c *ServerConn) NameList(path string) (entries []string, err error) {
-	conn, err := c.cmdDataConnFrom(0, "NLST %s", path)
+	return c.NameListContext(context.Background(), path)
+}
+
+// NameListContext is like NameList but with a context.
+func (c *ServerConn) NameListContext(ctx context.Context, path string) (entries []string, err error) {
+	conn, _, err := c.cmdDataConnFrom(ctx, 0, "NLST %s", path)
 	if err != nil {
 		return
 	}
 
-	r := &response{conn, c}
+	r := c.newResponse(ctx, conn)
 	defer r.Close()
 
 	scanner := bufio.NewScanner(r)
@@ -555,12 +1010,17 @@ func (c *ServerConn) NameList(path string) (entries []string, err error) {
 
 // List issues a LIST FTP command.
 func (c *ServerConn) List(path string) (entries []*ftps_qftp_client.Entry, err error) {
-	conn, err := c.cmdDataConnFrom(0, "LIST %s", path)
+	return c.ListContext(context.Background(), path)
+}
+
+// ListContext is like List but with a context.
+func (c *ServerConn) ListContext(ctx context.Context, path string) (entries []*ftps_qftp_client.Entry, err error) {
+	conn, _, err := c.cmdDataConnFrom(ctx, 0, "LIST %s", path)
 	if err != nil {
 		return
 	}
 
-	r := &response{conn, c}
+	r := c.newResponse(ctx, conn)
 	defer r.Close()
 
 	scanner := bufio.NewScanner(r)
@@ -577,10 +1037,106 @@ func (c *ServerConn) List(path string) (entries []*ftps_qftp_client.Entry, err e
 	return
 }
 
+// ListMachine issues a MLSD FTP command, which lists the directory in the
+// machine-readable format defined in RFC 3659. If the server does not support
+// MLST, it falls back to List.
+func (c *ServerConn) ListMachine(path string) (entries []*ftps_qftp_client.Entry, err error) {
+	return c.ListMachineContext(context.Background(), path)
+}
+
+// ListMachineContext is like ListMachine but with a context.
+func (c *ServerConn) ListMachineContext(ctx context.Context, path string) (entries []*ftps_qftp_client.Entry, err error) {
+	if _, mlstSupported := c.features["MLST"]; !mlstSupported {
+		return c.ListContext(ctx, path)
+	}
+
+	conn, _, err := c.cmdDataConnFrom(ctx, 0, "MLSD %s", path)
+	if err != nil {
+		return
+	}
+
+	r := c.newResponse(ctx, conn)
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		entry, err := parseRFC3659ListLine(line)
+		if err != nil {
+			return nil, errors.New("Invalid MLSD line \"" + line + "\". " + err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Stat issues a MLST FTP command, which returns the facts of a single file or
+// directory as defined in RFC 3659. If the server does not support MLST, the
+// entry is searched in the List of the parent directory.
+func (c *ServerConn) Stat(path string) (*ftps_qftp_client.Entry, error) {
+	return c.StatContext(context.Background(), path)
+}
+
+// StatContext is like Stat but with a context.
+func (c *ServerConn) StatContext(ctx context.Context, path string) (*ftps_qftp_client.Entry, error) {
+	if _, mlstSupported := c.features["MLST"]; !mlstSupported {
+		return c.statFromList(ctx, path)
+	}
+
+	_, msg, err := c.cmdContext(ctx, StatusRequestedFileActionOK, "MLST %s", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The facts are in the only line starting with a space
+	for _, line := range strings.Split(msg, "\n") {
+		if strings.HasPrefix(line, " ") {
+			return parseRFC3659ListLine(strings.TrimPrefix(line, " "))
+		}
+	}
+	return nil, errors.New("Unsupported MLST response format")
+}
+
+// statFromList searches the entry of a file or directory in the List of its
+// parent directory.
+func (c *ServerConn) statFromList(ctx context.Context, filePath string) (*ftps_qftp_client.Entry, error) {
+	dir, name := pathpkg.Split(strings.TrimSuffix(filePath, "/"))
+	if name == "" {
+		return nil, errors.New("Can not determine the entry of " + filePath + " without MLST support.")
+	}
+	if dir == "" {
+		dir = "."
+	} else if dir != "/" {
+		dir = strings.TrimSuffix(dir, "/")
+	}
+
+	entries, err := c.ListContext(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.FileName() == name {
+			return entry, nil
+		}
+	}
+	return nil, errors.New(filePath + " not found in the listing of " + dir + ".")
+}
+
 // ChangeDir issues a CWD FTP command, which changes the current directory to
 // the specified path.
 func (c *ServerConn) ChangeDir(path string) error {
-	_, _, err := c.cmd(StatusRequestedFileActionOK, "CWD %s", path)
+	return c.ChangeDirContext(context.Background(), path)
+}
+
+// ChangeDirContext is like ChangeDir but with a context.
+func (c *ServerConn) ChangeDirContext(ctx context.Context, path string) error {
+	_, _, err := c.cmdContext(ctx, StatusRequestedFileActionOK, "CWD %s", path)
 	return err
 }
 
@@ -588,14 +1144,24 @@ func (c *ServerConn) ChangeDir(path string) error {
 // directory to the parent directory.  This is similar to a call to ChangeDir
 // with a path set to "..".
 func (c *ServerConn) ChangeDirToParent() error {
-	_, _, err := c.cmd(StatusRequestedFileActionOK, "CDUP")
+	return c.ChangeDirToParentContext(context.Background())
+}
+
+// ChangeDirToParentContext is like ChangeDirToParent but with a context.
+func (c *ServerConn) ChangeDirToParentContext(ctx context.Context) error {
+	_, _, err := c.cmdContext(ctx, StatusRequestedFileActionOK, "CDUP")
 	return err
 }
 
 // CurrentDir issues a PWD FTP command, which Returns the path of the current
 // directory.
 func (c *ServerConn) CurrentDir() (string, error) {
-	_, msg, err := c.cmd(StatusPathCreated, "PWD")
+	return c.CurrentDirContext(context.Background())
+}
+
+// CurrentDirContext is like CurrentDir but with a context.
+func (c *ServerConn) CurrentDirContext(ctx context.Context) (string, error) {
+	_, msg, err := c.cmdContext(ctx, StatusPathCreated, "PWD")
 	if err != nil {
 		return "", err
 	}
@@ -610,25 +1176,312 @@ func (c *ServerConn) CurrentDir() (string, error) {
 	return msg[start+1 : end], nil
 }
 
+// FileSize issues a SIZE FTP command, which returns the size of the file in
+// bytes. SIZE is described in RFC 3659.
+func (c *ServerConn) FileSize(path string) (uint64, error) {
+	return c.FileSizeContext(context.Background(), path)
+}
+
+// FileSizeContext is like FileSize but with a context.
+func (c *ServerConn) FileSizeContext(ctx context.Context, path string) (uint64, error) {
+	_, msg, err := c.cmdContext(ctx, StatusFile, "SIZE %s", path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(msg), 10, 64)
+}
+
+// ModTime issues a MDTM FTP command, which returns the last modification time
+// of the file. MDTM is described in RFC 3659.
+func (c *ServerConn) ModTime(path string) (time.Time, error) {
+	return c.ModTimeContext(context.Background(), path)
+}
+
+// ModTimeContext is like ModTime but with a context.
+func (c *ServerConn) ModTimeContext(ctx context.Context, path string) (time.Time, error) {
+	_, msg, err := c.cmdContext(ctx, StatusFile, "MDTM %s", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// The time value may contain fractions of a second
+	return time.Parse("20060102150405", strings.TrimSpace(msg))
+}
+
+// SetModTime issues a MFMT FTP command, which sets the last modification time
+// of the file. MFMT is described in draft-somers-ftp-mfxx.
+func (c *ServerConn) SetModTime(path string, t time.Time) error {
+	return c.SetModTimeContext(context.Background(), path, t)
+}
+
+// SetModTimeContext is like SetModTime but with a context.
+func (c *ServerConn) SetModTimeContext(ctx context.Context, path string, t time.Time) error {
+	_, _, err := c.cmdContext(ctx, StatusFile, "MFMT %s %s", t.UTC().Format("20060102150405"), path)
+	return err
+}
+
+// Hash returns the hex encoded checksum of the file on the server computed
+// with the algorithm.
+// The HASH command (draft-bryan-ftpext-hash) is used, if the server lists it
+// in FEAT, the algorithm is selected with OPTS HASH. Otherwise the older
+// commands XSHA256, XSHA1, XMD5 and XCRC are used.
+// An empty algorithm is SHA-256 with HASH, without HASH the older commands
+// are tried in this order and the checksum of the first implemented one is
+// returned, its algorithm is recognizable by the length.
+// A *ftps_qftp_client.HashUnsupportedError is returned, if the server does
+// not implement the command.
+func (c *ServerConn) Hash(path string, algorithm ftps_qftp_client.HashAlgorithm) (string, error) {
+	return c.HashContext(context.Background(), path, algorithm)
+}
+
+// HashContext is like Hash but with a context.
+func (c *ServerConn) HashContext(ctx context.Context, path string, algorithm ftps_qftp_client.HashAlgorithm) (string, error) {
+	feature, hashCommand := c.features["HASH"]
+	if algorithm == "" {
+		if !hashCommand {
+			for _, algorithm := range ftps_qftp_client.HashAlgorithms {
+				checksum, err := c.legacyHash(ctx, path, algorithm)
+				if _, unsupported := err.(*ftps_qftp_client.HashUnsupportedError); !unsupported {
+					return checksum, err
+				}
+			}
+			return "", &ftps_qftp_client.HashUnsupportedError{}
+		}
+		algorithm = ftps_qftp_client.HashSHA256
+	}
+
+	if hashCommand {
+		if supported, selected := ftps_qftp_client.HashFeature(feature, algorithm); supported {
+			// The selection of FEAT is valid until OPTS HASH
+			current := c.hashAlgorithm
+			if current == "" && selected {
+				current = algorithm
+			}
+			if current != algorithm {
+				_, _, err := c.cmdContext(ctx, StatusCommandOK, "OPTS HASH %s", algorithm)
+				if err != nil {
+					return "", err
+				}
+				c.hashAlgorithm = algorithm
+			}
+
+			// e.g. 213 SHA-256 0-49 169cd22282da7f147cb491e559e9dd filename
+			_, msg, err := c.cmdContext(ctx, StatusFile, "HASH %s", path)
+			if err != nil {
+				return "", err
+			}
+			fields := strings.Fields(msg)
+			if len(fields) < 3 {
+				return "", errors.New("Invalid HASH reply " + msg + ".")
+			}
+			return ftps_qftp_client.NormalizeHash(algorithm, fields[2]), nil
+		}
+	}
+
+	return c.legacyHash(ctx, path, algorithm)
+}
+
+// legacyHash requests the checksum with the command of the algorithm like
+// XSHA256, which is used by servers without HASH.
+func (c *ServerConn) legacyHash(ctx context.Context, path string, algorithm ftps_qftp_client.HashAlgorithm) (string, error) {
+	command := algorithm.LegacyCommand()
+	if command == "" {
+		return "", errors.New("Unknown hash algorithm " + string(algorithm) + ".")
+	}
+	code, msg, err := c.cmdContext(ctx, -1, "%s %s", command, path)
+	if err != nil {
+		return "", err
+	}
+	switch code {
+	case StatusRequestedFileActionOK, StatusFile:
+	case StatusBadCommand, StatusNotImplemented, StatusNotImplementedParameter:
+		return "", &ftps_qftp_client.HashUnsupportedError{Algorithm: algorithm}
+	default:
+		return "", &textproto.Error{Code: code, Msg: msg}
+	}
+	fields := strings.Fields(msg)
+	if len(fields) == 0 {
+		return "", errors.New("Invalid " + command + " reply.")
+	}
+	return ftps_qftp_client.NormalizeHash(algorithm, fields[0]), nil
+}
+
+// SetTransferVerification enables the verification of complete binary
+// transfers of Retr and Stor. After the transfer the checksum of the file
+// on the server is compared with the one of the transferred data, a
+// mismatch is returned as *ftps_qftp_client.ChecksumError. The verification
+// is skipped, if the server does not support the algorithm.
+// An empty algorithm disables the verification.
+func (c *ServerConn) SetTransferVerification(algorithm ftps_qftp_client.HashAlgorithm) error {
+	if algorithm != "" {
+		if _, err := algorithm.New(); err != nil {
+			return err
+		}
+	}
+	c.verifyAlgorithm = algorithm
+	return nil
+}
+
+// SetProgressFunc sets the function, which is called with the progress of
+// the transfers of Retr, RetrFrom, Stor and StorFrom. The size of a retrieved
+// file is requested with SIZE before the transfer. MultipleTransfer also
+// reports the progress of the whole job. A nil function disables the reports.
+func (c *ServerConn) SetProgressFunc(fn ftps_qftp_client.ProgressFunc) {
+	c.progressFunc = fn
+}
+
+// newVerificationHash returns the hash for the verification of a transfer or
+// nil, if the transfer is not verified.
+func (c *ServerConn) newVerificationHash(offset uint64) hash.Hash {
+	if c.verifyAlgorithm == "" || offset != 0 || c.transferType == ftps_qftp_client.TransferTypeASCII {
+		return nil
+	}
+	h, _ := c.verifyAlgorithm.New()
+	return h
+}
+
+// verifyTransfer compares the checksum of the transferred data with the one
+// of the file on the server.
+func (c *ServerConn) verifyTransfer(ctx context.Context, path string, h hash.Hash) error {
+	remote, err := c.HashContext(ctx, path, c.verifyAlgorithm)
+	if _, unsupported := err.(*ftps_qftp_client.HashUnsupportedError); unsupported {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	local := ftps_qftp_client.NormalizeHash(c.verifyAlgorithm, hex.EncodeToString(h.Sum(nil)))
+	if local != remote {
+		return &ftps_qftp_client.ChecksumError{Path: path, Algorithm: c.verifyAlgorithm, Local: local, Remote: remote}
+	}
+	return nil
+}
+
+// EnableCompression issues a MODE Z FTP command, so the data of the following
+// transfers and listings is compressed with deflate. The compression level of
+// the server is set with OPTS MODE Z LEVEL, if level is between 1 and 9.
+// The compression is transparent for the callers of Retr, Stor and List.
+// MODE Z is described in draft-preston-ftpext-deflate.
+func (c *ServerConn) EnableCompression(level int) error {
+	return c.EnableCompressionContext(context.Background(), level)
+}
+
+// EnableCompressionContext is like EnableCompression but with a context.
+func (c *ServerConn) EnableCompressionContext(ctx context.Context, level int) error {
+	if strings.ToUpper(c.features["MODE"]) != "Z" {
+		return errors.New("The server does not support MODE Z.")
+	}
+
+	_, _, err := c.cmdContext(ctx, StatusCommandOK, "MODE Z")
+	if err != nil {
+		return err
+	}
+	c.compression = true
+	c.compressionLevel = zlib.DefaultCompression
+
+	if level >= zlib.BestSpeed && level <= zlib.BestCompression {
+		_, _, err = c.cmdContext(ctx, StatusCommandOK, "OPTS MODE Z LEVEL %d", level)
+		if err != nil {
+			return err
+		}
+		c.compressionLevel = level
+	}
+	return nil
+}
+
+// DisableCompression issues a MODE S FTP command to transfer the data
+// uncompressed again.
+func (c *ServerConn) DisableCompression() error {
+	return c.DisableCompressionContext(context.Background())
+}
+
+// DisableCompressionContext is like DisableCompression but with a context.
+func (c *ServerConn) DisableCompressionContext(ctx context.Context) error {
+	_, _, err := c.cmdContext(ctx, StatusCommandOK, "MODE S")
+	if err != nil {
+		return err
+	}
+	c.compression = false
+	return nil
+}
+
+// SetTransferType issues a TYPE FTP command to set the representation type
+// of the transferred files. In ASCII mode Retr and Stor convert between the
+// local newline convention and CRLF. The type is kept after Login.
+func (c *ServerConn) SetTransferType(transferType ftps_qftp_client.TransferType) error {
+	return c.SetTransferTypeContext(context.Background(), transferType)
+}
+
+// SetTransferTypeContext is like SetTransferType but with a context.
+func (c *ServerConn) SetTransferTypeContext(ctx context.Context, transferType ftps_qftp_client.TransferType) error {
+	_, _, err := c.cmdContext(ctx, StatusCommandOK, "TYPE %c", transferType)
+	if err != nil {
+		return err
+	}
+	c.transferType = transferType
+	return nil
+}
+
 // Retr issues a RETR FTP command to fetch the specified file from the remote
 // FTP server.
 //
-// The returned ReadCloser must be closed to cleanup the FTP data connection.
+// The returned ReadCloser must be closed to cleanup the FTP data connection,
+// closing it before the end of the file aborts the transfer.
 func (c *ServerConn) Retr(path string) (io.ReadCloser, error) {
-	return c.RetrFrom(path, 0)
+	return c.RetrContext(context.Background(), path)
+}
+
+// RetrContext is like Retr but with a context.
+func (c *ServerConn) RetrContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	return c.RetrFromContext(ctx, path, 0)
 }
 
 // RetrFrom issues a RETR FTP command to fetch the specified file from the remote
 // FTP server, the server will not send the offset first bytes of the file.
+// In ASCII mode offset counts the bytes of the NVT-ASCII data, see
+// ftps_qftp_client.NVTLength.
 //
-// The returned ReadCloser must be closed to cleanup the FTP data connection.
+// The returned ReadCloser must be closed to cleanup the FTP data connection,
+// closing it before the end of the file aborts the transfer.
 func (c *ServerConn) RetrFrom(path string, offset uint64) (io.ReadCloser, error) {
-	conn, err := c.cmdDataConnFrom(offset, "RETR %s", path)
+	return c.RetrFromContext(context.Background(), path, offset)
+}
+
+// RetrFromContext is like RetrFrom but with a context.
+func (c *ServerConn) RetrFromContext(ctx context.Context, path string, offset uint64) (io.ReadCloser, error) {
+	// The size of the file for the progress, unknown if SIZE fails
+	total := int64(-1)
+	if c.progressFunc != nil {
+		if size, err := c.FileSizeContext(ctx, path); err == nil {
+			total = int64(size)
+		}
+	}
+
+	conn, _, err := c.cmdDataConnFrom(ctx, offset, "RETR %s", path)
 	if err != nil {
 		return nil, err
 	}
 
-	return &response{conn, c}, nil
+	r := c.newResponse(ctx, conn)
+	if c.transferType == ftps_qftp_client.TransferTypeASCII {
+		r.data = ftps_qftp_client.NewNVTDecoder(r.data)
+	}
+	if h := c.newVerificationHash(offset); h != nil {
+		r.hash = h
+		r.path = path
+	}
+	if c.progressFunc != nil {
+		r.progress = ftps_qftp_client.NewProgressReader(r.data, path, int64(offset), total, c.progressFunc)
+		r.data = r.progress
+	}
+	return r, nil
+}
+
+// OpenRemoteFile opens the specified file on the remote FTP server for
+// random access with RetrFrom, see ftps_qftp_client.RemoteFile.
+// The file must be closed before the connection is used for other operations.
+func (c *ServerConn) OpenRemoteFile(path string) (*ftps_qftp_client.RemoteFile, error) {
+	return ftps_qftp_client.OpenRemoteFile(c, path)
 }
 
 // Stor issues a STOR FTP command to store a file to the remote FTP server.
@@ -636,34 +1489,274 @@ func (c *ServerConn) RetrFrom(path string, offset uint64) (io.ReadCloser, error)
 //
 // Hint: io.Pipe() can be used if an io.Writer is required.
 func (c *ServerConn) Stor(path string, r io.Reader) error {
-	return c.StorFrom(path, r, 0)
+	return c.StorContext(context.Background(), path, r)
+}
+
+// StorContext is like Stor but with a context.
+func (c *ServerConn) StorContext(ctx context.Context, path string, r io.Reader) error {
+	return c.StorFromContext(ctx, path, r, 0)
 }
 
 // StorFrom issues a STOR FTP command to store a file to the remote FTP server.
 // Stor creates the specified file with the content of the io.Reader, writing
 // on the server will start at the given file offset.
+// In ASCII mode offset counts the bytes of the NVT-ASCII data, see
+// ftps_qftp_client.NVTLength.
 //
 // Hint: io.Pipe() can be used if an io.Writer is required.
 func (c *ServerConn) StorFrom(path string, r io.Reader, offset uint64) error {
-	conn, err := c.cmdDataConnFrom(offset, "STOR %s", path)
+	return c.StorFromContext(context.Background(), path, r, offset)
+}
+
+// StorFromContext is like StorFrom but with a context.
+func (c *ServerConn) StorFromContext(ctx context.Context, path string, r io.Reader, offset uint64) error {
+	var progress *ftps_qftp_client.ProgressReader
+	if c.progressFunc != nil {
+		total := int64(-1)
+		if length := ftps_qftp_client.RemainingLength(r); length >= 0 {
+			total = int64(offset) + length
+		}
+		progress = ftps_qftp_client.NewProgressReader(r, path, int64(offset), total, c.progressFunc)
+		r = progress
+	}
+
+	conn, _, err := c.cmdDataConnFrom(ctx, offset, "STOR %s", path)
+	if err != nil {
+		if progress != nil {
+			progress.Finish(err)
+		}
+		return err
+	}
+
+	h := c.newVerificationHash(offset)
+	_, err = c.storData(ctx, conn, r, h)
+	if err == nil && h != nil {
+		err = c.verifyTransfer(ctx, path, h)
+	}
+	if progress != nil {
+		progress.Finish(err)
+	}
+	return err
+}
+
+// Append issues a APPE FTP command to append the content of the io.Reader
+// to the specified file on the remote FTP server. The file is created, if it
+// does not exist.
+func (c *ServerConn) Append(path string, r io.Reader) error {
+	return c.AppendContext(context.Background(), path, r)
+}
+
+// AppendContext is like Append but with a context.
+func (c *ServerConn) AppendContext(ctx context.Context, path string, r io.Reader) error {
+	conn, _, err := c.cmdDataConnFrom(ctx, 0, "APPE %s", path)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(conn, r)
-	conn.Close()
+	_, err = c.storData(ctx, conn, r, nil)
+	return err
+}
+
+// StorUnique issues a STOU FTP command to store the content of the io.Reader
+// in a new file with a unique name chosen by the server. It returns the name
+// of the file, which is parsed from the replies of the server.
+func (c *ServerConn) StorUnique(r io.Reader) (string, error) {
+	return c.StorUniqueContext(context.Background(), r)
+}
+
+// StorUniqueContext is like StorUnique but with a context.
+func (c *ServerConn) StorUniqueContext(ctx context.Context, r io.Reader) (string, error) {
+	conn, msg, err := c.cmdDataConnFrom(ctx, 0, "STOU")
+	if err != nil {
+		return "", err
+	}
+
+	h := c.newVerificationHash(0)
+	finalMsg, err := c.storData(ctx, conn, r, h)
 	if err != nil {
+		return "", err
+	}
+
+	name := parseUniqueName(msg)
+	if name == "" {
+		name = parseUniqueName(finalMsg)
+	}
+	if name == "" {
+		return "", errors.New("The server did not report the name of the stored file.")
+	}
+	if h != nil {
+		err = c.verifyTransfer(ctx, name, h)
+	}
+	return name, err
+}
+
+// ResumeRetr downloads the specified file from the remote FTP server to the
+// local file. If the local file is shorter than the file on the server, only
+// the missing part is retrieved and appended. Otherwise or if the server does
+// not accept REST, the whole file is retrieved. Nothing is transferred, if
+// both files have the same size.
+// In ASCII mode the sizes are not comparable and the whole file is retrieved.
+func (c *ServerConn) ResumeRetr(remote string, localFile string) error {
+	return c.ResumeRetrContext(context.Background(), remote, localFile)
+}
+
+// ResumeRetrContext is like ResumeRetr but with a context.
+func (c *ServerConn) ResumeRetrContext(ctx context.Context, remote string, localFile string) error {
+	// The local file is only created, when the server sends the file
+	info, err := os.Stat(localFile)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
-	_, _, err = c.conn.ReadResponse(StatusClosingDataConnection)
+	var offset uint64
+	if info != nil && c.transferType != ftps_qftp_client.TransferTypeASCII {
+		remoteSize, err := c.remoteSize(ctx, remote)
+		localSize := uint64(info.Size())
+		if err == nil && localSize == remoteSize {
+			return nil
+		} else if err == nil && localSize < remoteSize {
+			offset = localSize
+		}
+	}
+
+	r, err := c.RetrFromContext(ctx, remote, offset)
+	if _, ok := err.(*restartError); ok {
+		offset = 0
+		r, err = c.RetrFromContext(ctx, remote, offset)
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(localFile, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	defer file.Close()
+	err = file.Truncate(int64(offset))
+	if err == nil {
+		_, err = file.Seek(int64(offset), io.SeekStart)
+	}
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+	if err != nil {
+		r.Close()
+		return err
+	}
+	return r.Close()
+}
+
+// ResumeStor uploads the local file to the specified file on the remote FTP
+// server. If the file on the server is shorter than the local file, only the
+// missing part is stored. Otherwise or if the server does not accept REST,
+// the whole file is stored. Nothing is transferred, if both files have the
+// same size.
+// In ASCII mode the sizes are not comparable and the whole file is stored.
+func (c *ServerConn) ResumeStor(localFile string, remote string) error {
+	return c.ResumeStorContext(context.Background(), localFile, remote)
+}
+
+// ResumeStorContext is like ResumeStor but with a context.
+func (c *ServerConn) ResumeStorContext(ctx context.Context, localFile string, remote string) error {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset uint64
+	if c.transferType != ftps_qftp_client.TransferTypeASCII {
+		remoteSize, err := c.remoteSize(ctx, remote)
+		localSize := uint64(info.Size())
+		if err == nil && localSize == remoteSize {
+			return nil
+		} else if err == nil && remoteSize < localSize {
+			offset = remoteSize
+		}
+	}
+
+	_, err = file.Seek(int64(offset), io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = c.StorFromContext(ctx, remote, file, offset)
+	if _, ok := err.(*restartError); ok {
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		err = c.StorFromContext(ctx, remote, file, 0)
+	}
 	return err
 }
 
+// remoteSize returns the size of the file on the server with SIZE or, if
+// SIZE fails, with MLST or LIST.
+func (c *ServerConn) remoteSize(ctx context.Context, path string) (uint64, error) {
+	size, err := c.FileSizeContext(ctx, path)
+	if err == nil {
+		return size, nil
+	}
+	entry, statErr := c.StatContext(ctx, path)
+	if statErr != nil {
+		return 0, err
+	}
+	return entry.Size, nil
+}
+
+// storData sends the content of the io.Reader over the data connection of a
+// STOR, APPE or STOU command and returns the message of the final reply.
+// The sent data is written to h, if it is not nil.
+func (c *ServerConn) storData(ctx context.Context, conn net.Conn, r io.Reader, h hash.Hash) (string, error) {
+	stop := watchContext(ctx, func() {
+		conn.SetDeadline(aLongTimeAgo)
+	})
+	if h != nil {
+		r = io.TeeReader(r, h)
+	}
+	if c.transferType == ftps_qftp_client.TransferTypeASCII {
+		r = ftps_qftp_client.NewNVTEncoder(r)
+	}
+	var w io.Writer = conn
+	var zw *zlib.Writer
+	if c.compression {
+		// the level was checked by EnableCompression
+		zw, _ = zlib.NewWriterLevel(conn, c.compressionLevel)
+		w = zw
+	}
+	_, err := io.Copy(w, r)
+	if err == nil && zw != nil {
+		// write the end of the compressed stream
+		err = zw.Close()
+	}
+	stop()
+	if err != nil {
+		c.abort(ctx, conn)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+	conn.Close()
+
+	_, msg, err := c.readResponse(ctx, StatusClosingDataConnection)
+	return msg, err
+}
+
 // MultipleTransfer issues STOR FTP commands in parallel connections to store multiple files
 // to the remote FTP server.
 // Stor creates the specified files as specified in tasks. The number of parallel
 // connections can be limited. nrParallel < 0 means no limit
+// The errors of the transfers are returned as *ftps_qftp_client.MultipleErrors,
+// the transfers are verified like with SetTransferVerification.
+// The progress of the transfers is reported with the progress of the whole
+// job, see SetProgressFunc.
 //
 // Hint: io.Pipe() can be used if an io.Writer is required.
 func (c *ServerConn) MultipleTransfer(tasks []TransferTask, nrParallel int) error {
@@ -677,6 +1770,14 @@ func (c *ServerConn) MultipleTransfer(tasks []TransferTask, nrParallel int) erro
 		nrParallel = len(tasks)
 	}
 
+	// The progress of the transfers is reported with the progress of the job
+	progress := c.progressFunc
+	if progress != nil {
+		defer c.SetProgressFunc(progress)
+		progress = ftps_qftp_client.NewJobProgressFunc(len(tasks), progress)
+		c.progressFunc = progress
+	}
+
 	// Write all tasks to the channel including the finishing message
 	taskChannel := make(chan TransferTask, len(tasks)+nrParallel)
 	returnChannel := make(chan error, len(tasks))
@@ -690,7 +1791,7 @@ func (c *ServerConn) MultipleTransfer(tasks []TransferTask, nrParallel int) erro
 
 	// Start goroutines for parallel connections and provide the channels for communication
 	for i := 0; i < nrParallel-1; i++ {
-		go c.parallelTransfer(c.hostname+":"+c.hostcontrolport, currentdirctory, c.tlsSecuredControlConnection, c.certfilename, taskChannel, returnChannel)
+		go c.parallelTransfer(currentdirctory, taskChannel, returnChannel, progress)
 	}
 	// The main connection is also used for parallel transfer
 	for {
@@ -706,53 +1807,111 @@ func (c *ServerConn) MultipleTransfer(tasks []TransferTask, nrParallel int) erro
 		}
 	}
 
-	errorMessage := ""
+	var transferErrors []error
 	// Wait for replais of the STORs in the goroutines
 	for normalReplay, goRoutineResetReply := 0, 0; normalReplay < len(tasks) && goRoutineResetReply < nrParallel; normalReplay++ {
 		replay := <-returnChannel
 		if replay != nil {
-			errorMessage = errorMessage + "\n" + replay.Error()
+			transferErrors = append(transferErrors, replay)
 			if strings.HasPrefix("Go routine reset.", replay.Error()) {
 				goRoutineResetReply++
 			}
 		}
 	}
-	if errorMessage == "" {
+	if len(transferErrors) == 0 {
 		return nil
 	} else {
-		return errors.New(errorMessage)
+		return &ftps_qftp_client.MultipleErrors{Errors: transferErrors}
 	}
 }
 
 // Rename renames a file on the remote FTP server.
 func (c *ServerConn) Rename(from, to string) error {
-	_, _, err := c.cmd(StatusRequestFilePending, "RNFR %s", from)
+	return c.RenameContext(context.Background(), from, to)
+}
+
+// RenameContext is like Rename but with a context.
+func (c *ServerConn) RenameContext(ctx context.Context, from, to string) error {
+	_, _, err := c.cmdContext(ctx, StatusRequestFilePending, "RNFR %s", from)
 	if err != nil {
 		return err
 	}
 
-	_, _, err = c.cmd(StatusRequestedFileActionOK, "RNTO %s", to)
+	_, _, err = c.cmdContext(ctx, StatusRequestedFileActionOK, "RNTO %s", to)
 	return err
 }
 
 // Delete issues a DELE FTP command to delete the specified file from the
 // remote FTP server.
 func (c *ServerConn) Delete(path string) error {
-	_, _, err := c.cmd(StatusRequestedFileActionOK, "DELE %s", path)
+	return c.DeleteContext(context.Background(), path)
+}
+
+// DeleteContext is like Delete but with a context.
+func (c *ServerConn) DeleteContext(ctx context.Context, path string) error {
+	_, _, err := c.cmdContext(ctx, StatusRequestedFileActionOK, "DELE %s", path)
 	return err
 }
 
 // MakeDir issues a MKD FTP command to create the specified directory on the
 // remote FTP server.
 func (c *ServerConn) MakeDir(path string) error {
-	_, _, err := c.cmd(StatusPathCreated, "MKD %s", path)
+	return c.MakeDirContext(context.Background(), path)
+}
+
+// MakeDirContext is like MakeDir but with a context.
+func (c *ServerConn) MakeDirContext(ctx context.Context, path string) error {
+	_, _, err := c.cmdContext(ctx, StatusPathCreated, "MKD %s", path)
+	return err
+}
+
+// MakeDirAll creates the specified directory on the remote FTP server
+// together with all missing parent directories. Existing directories, which
+// are reported with 550 or 521 replies to MKD, are no error.
+func (c *ServerConn) MakeDirAll(path string) error {
+	return c.MakeDirAllContext(context.Background(), path)
+}
+
+// MakeDirAllContext is like MakeDirAll but with a context.
+func (c *ServerConn) MakeDirAllContext(ctx context.Context, path string) error {
+	dir := ""
+	if strings.HasPrefix(path, "/") {
+		dir = "/"
+	}
+	for _, name := range strings.Split(path, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		dir = pathpkg.Join(dir, name)
+		err := c.makeDirIfMissing(ctx, dir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeDirIfMissing issues a MKD FTP command and accepts the replies to an
+// existing directory.
+func (c *ServerConn) makeDirIfMissing(ctx context.Context, path string) error {
+	err := c.MakeDirContext(ctx, path)
+	if protoErr, ok := err.(*textproto.Error); ok {
+		if protoErr.Code == StatusFileUnavailable || protoErr.Code == StatusDirectoryExists {
+			return nil
+		}
+	}
 	return err
 }
 
 // RemoveDir issues a RMD FTP command to remove the specified directory from
 // the remote FTP server.
 func (c *ServerConn) RemoveDir(path string) error {
-	_, _, err := c.cmd(StatusRequestedFileActionOK, "RMD %s", path)
+	return c.RemoveDirContext(context.Background(), path)
+}
+
+// RemoveDirContext is like RemoveDir but with a context.
+func (c *ServerConn) RemoveDirContext(ctx context.Context, path string) error {
+	_, _, err := c.cmdContext(ctx, StatusRequestedFileActionOK, "RMD %s", path)
 	return err
 }
 
@@ -760,20 +1919,35 @@ func (c *ServerConn) RemoveDir(path string) error {
 // NOOP has no effects and is usually used to prevent the remote FTP server to
 // close the otherwise idle connection.
 func (c *ServerConn) NoOp() error {
-	_, _, err := c.cmd(StatusCommandOK, "NOOP")
+	return c.NoOpContext(context.Background())
+}
+
+// NoOpContext is like NoOp but with a context.
+func (c *ServerConn) NoOpContext(ctx context.Context) error {
+	_, _, err := c.cmdContext(ctx, StatusCommandOK, "NOOP")
 	return err
 }
 
 // Logout issues a REIN FTP command to logout the current user.
 func (c *ServerConn) Logout() error {
-	_, _, err := c.cmd(StatusReady, "REIN")
+	return c.LogoutContext(context.Background())
+}
+
+// LogoutContext is like Logout but with a context.
+func (c *ServerConn) LogoutContext(ctx context.Context) error {
+	_, _, err := c.cmdContext(ctx, StatusReady, "REIN")
 	return err
 }
 
 // Quit issues a QUIT FTP command to properly close the connection from the
 // remote FTP server.
 func (c *ServerConn) Quit() error {
-	_, _, err := c.cmd(StatusClosing, "QUIT")
+	return c.QuitContext(context.Background())
+}
+
+// QuitContext is like Quit but with a context.
+func (c *ServerConn) QuitContext(ctx context.Context) error {
+	_, _, err := c.cmdContext(ctx, StatusClosing, "QUIT")
 	if err != nil {
 		return err
 	}
@@ -782,15 +1956,41 @@ func (c *ServerConn) Quit() error {
 
 // Read implements the io.Reader interface on a FTP data connection.
 func (r *response) Read(buf []byte) (int, error) {
-	return r.conn.Read(buf)
+	n, err := r.data.Read(buf)
+	if r.hash != nil {
+		r.hash.Write(buf[:n])
+	}
+	if err == io.EOF {
+		r.eof = true
+	} else if err != nil && r.ctx.Err() != nil {
+		err = r.ctx.Err()
+	}
+	return n, err
 }
 
 // Close implements the io.Closer interface on a FTP data connection.
+// If the transfer is not complete, it is aborted.
 func (r *response) Close() error {
+	err := r.close()
+	if r.progress != nil {
+		r.progress.Finish(err)
+	}
+	return err
+}
+
+// close closes the data connection and reads the reply of the transfer.
+func (r *response) close() error {
+	r.stop()
+	if !r.eof {
+		return r.c.abort(r.ctx, r.conn)
+	}
 	err := r.conn.Close()
-	_, _, err2 := r.c.conn.ReadResponse(StatusClosingDataConnection)
+	_, _, err2 := r.c.readResponse(r.ctx, StatusClosingDataConnection)
 	if err2 != nil {
-		err = err2
+		return err2
+	}
+	if r.hash != nil {
+		return r.c.verifyTransfer(r.ctx, r.path, r.hash)
 	}
 	return err
 }
@@ -0,0 +1,140 @@
+package ftps
+
+import (
+	"github.com/attenberger/ftps_qftp-client"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21226"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksum, err := c.Hash("welcome.msg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum != "280d44ab1e9f79b5cce2dd4f58f5fe91f0fbacdac9f7447dffc318ceb79f2d02" {
+		t.Errorf("unexpected SHA-256 %s", checksum)
+	}
+
+	checksum, err = c.Hash("welcome.msg", ftps_qftp_client.HashMD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum != "40be4e59b9a2a2b5dffb918c0e86b3d7" {
+		t.Errorf("unexpected MD5 %s", checksum)
+	}
+
+	err = c.SetTransferVerification(ftps_qftp_client.HashSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := strings.Repeat("date;value\n", 100)
+	err = c.Stor("report.csv", strings.NewReader(content))
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, path := range []string{"welcome.msg", "corrupt.bin"} {
+		r, err := c.Retr(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ioutil.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+		}
+		err = r.Close()
+		if path == "welcome.msg" && err != nil {
+			t.Error(err)
+		}
+		if path == "corrupt.bin" {
+			if checksumErr, ok := err.(*ftps_qftp_client.ChecksumError); !ok || checksumErr.Path != path {
+				t.Errorf("expected ChecksumError, got %v", err)
+			}
+		}
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	expected := []string{"FEAT", "HASH", "OPTS", "HASH", "PASV", "STOR", "OPTS", "HASH",
+		"PASV", "RETR", "HASH", "PASV", "RETR", "HASH", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
+
+func TestHashLegacyCommands(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21263"
+	mock := newFtpMock(t, address)
+	mock.noHash = true
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without an algorithm the first implemented command is used
+	checksum, err := c.Hash("welcome.msg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum != "40be4e59b9a2a2b5dffb918c0e86b3d7" {
+		t.Errorf("unexpected MD5 %s", checksum)
+	}
+
+	_, err = c.Hash("welcome.msg", ftps_qftp_client.HashCRC32)
+	if unsupportedErr, ok := err.(*ftps_qftp_client.HashUnsupportedError); !ok || unsupportedErr.Algorithm != ftps_qftp_client.HashCRC32 {
+		t.Errorf("expected HashUnsupportedError, got %v", err)
+	}
+
+	// The verification is skipped
+	err = c.SetTransferVerification(ftps_qftp_client.HashSHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Retr("corrupt.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	expected := []string{"FEAT", "XSHA256", "XSHA1", "XMD5", "XCRC", "PASV", "RETR", "XSHA1", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
@@ -0,0 +1,156 @@
+package ftps
+
+import (
+	"github.com/attenberger/ftps_qftp-client"
+	"net/textproto"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileMetadata(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21213"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := c.FileSize("welcome.msg")
+	if err != nil {
+		t.Error(err)
+	} else if size != 951 {
+		t.Errorf("FileSize = %d, want 951", size)
+	}
+
+	modTime := time.Date(2015, time.August, 13, 17, 52, 50, 0, time.UTC)
+	mtime, err := c.ModTime("welcome.msg")
+	if err != nil {
+		t.Error(err)
+	} else if !mtime.Equal(modTime) {
+		t.Errorf("ModTime = %v, want %v", mtime, modTime)
+	}
+
+	err = c.SetModTime("welcome.msg", modTime)
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	expected := []string{"FEAT", "SIZE", "MDTM", "MFMT", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
+
+func TestMachineListing(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21260"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := c.ListMachine("tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2015, time.August, 13, 0, 0, 0, 0, time.UTC)
+	expected := []ftps_qftp_client.Entry{
+		{Name: "tree", Type: ftps_qftp_client.EntryTypeFolder, Time: modTime, Mode: 0755},
+		{Name: "sub", Type: ftps_qftp_client.EntryTypeFolder, Time: modTime, Mode: 0755},
+		{Name: "a.txt", Type: ftps_qftp_client.EntryTypeFile, Size: 7, Time: modTime, Mode: 0644},
+		{Name: "link", Type: ftps_qftp_client.EntryTypeLink, Size: 5, Time: modTime, Mode: 0777},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	for i, entry := range entries {
+		entry.Facts = nil
+		if !reflect.DeepEqual(*entry, expected[i]) {
+			t.Errorf("unexpected entry %+v, expected %+v", *entry, expected[i])
+		}
+	}
+
+	entry, err := c.Stat("tree/sub/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "tree/sub/b.txt" || entry.Type != ftps_qftp_client.EntryTypeFile || entry.Size != 7 || !entry.Time.Equal(modTime) {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	_, err = c.Stat("tree/missing.txt")
+	if protoErr, ok := err.(*textproto.Error); !ok || protoErr.Code != StatusFileUnavailable {
+		t.Errorf("expected the reply 550, got %v", err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	commands := []string{"FEAT", "PASV", "MLSD", "MLST", "MLST", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, commands) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", commands)
+	}
+}
+
+func TestStatFromList(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21261"
+	mock := newFtpMock(t, address)
+	mock.noMachineListing = true
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := c.Stat("tree/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Name != "a.txt" || entry.Type != ftps_qftp_client.EntryTypeFile || entry.Size != 7 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	// LIST appends the target to the name of a link
+	entry, err = c.Stat("tree/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.FileName() != "link" || entry.Type != ftps_qftp_client.EntryTypeLink {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	commands := []string{"FEAT", "PASV", "LIST", "PASV", "LIST", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, commands) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", commands)
+	}
+}
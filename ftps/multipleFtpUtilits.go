@@ -4,9 +4,16 @@
 package ftps
 
 import (
+	"context"
 	"errors"
+	"github.com/attenberger/ftps_qftp-client"
 	"io"
+	"io/ioutil"
+	"net/textproto"
 	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -22,6 +29,7 @@ type TransferTask struct {
 	localpath  string
 	remotepath string
 	direction  TransferDirction
+	resume     bool // continue an interrupted transfer, see ResumeRetr and ResumeStor
 	finished   bool
 }
 
@@ -30,37 +38,23 @@ func NewTransferTask(direction TransferDirction, localpath string, remotepath st
 	return TransferTask{localpath: localpath, remotepath: remotepath, direction: direction, finished: false}
 }
 
+// Creates a new TransferTask, which continues an interrupted transfer of the
+// file. Just the missing part of the file is transferred.
+func NewResumeTransferTask(direction TransferDirction, localpath string, remotepath string) TransferTask {
+	return TransferTask{localpath: localpath, remotepath: remotepath, direction: direction, resume: true, finished: false}
+}
+
 // Runs a parallel transfer.
 // In the taskChannel it gets the TransferTask to perform.
 // In the returnChannel it returns occured error or nil for success
-func (c *ServerConn) parallelTransfer(serveraddr string, dirctory string, secure bool, serverCertFilename string, taskChannel chan TransferTask, returnChannel chan error) {
-	// Open Controlconnection
-	conn, err := DialTimeout(serveraddr, time.Second*30, serverCertFilename)
+func (c *ServerConn) parallelTransfer(dirctory string, taskChannel chan TransferTask, returnChannel chan error, progress ftps_qftp_client.ProgressFunc) {
+	conn, err := c.openParallelConn(context.Background(), dirctory)
 	if err != nil {
 		returnChannel <- errors.New("Go routine reset. " + err.Error())
 		return
 	}
 	defer conn.Quit()
-	// Secure if main connection is secured
-	if secure {
-		err = conn.AuthTLS()
-		if err != nil {
-			returnChannel <- errors.New("Go routine reset. " + err.Error())
-			return
-		}
-	}
-	// Login in
-	err = conn.Login(c.username, c.password)
-	if err != nil {
-		returnChannel <- errors.New("Go routine reset. " + err.Error())
-		return
-	}
-	// Change to directory of the main connection
-	err = conn.ChangeDir(dirctory)
-	if err != nil {
-		returnChannel <- errors.New("Go routine reset. " + err.Error())
-		return
-	}
+	conn.progressFunc = progress
 
 	// run tasks
 	for {
@@ -77,8 +71,249 @@ func (c *ServerConn) parallelTransfer(serveraddr string, dirctory string, secure
 	}
 }
 
+// openParallelConn opens an additional connection to the server with the
+// settings of c, logs in and changes to the directory.
+func (c *ServerConn) openParallelConn(ctx context.Context, dirctory string) (*ServerConn, error) {
+	// Open Controlconnection
+	conn, err := DialWithConfig(c.hostname+":"+c.hostcontrolport, DialConfig{Timeout: time.Second * 30, TLS: c.tlsOptions, Implicit: c.implicitTLS, ImplicitTLS: c.authTLSOptions})
+	if err != nil {
+		return nil, err
+	}
+	conn.activeMode = c.activeMode
+	conn.transferType = c.transferType
+	conn.verifyAlgorithm = c.verifyAlgorithm
+	// Secure if main connection is secured
+	if c.tlsNegotiated && !conn.tlsNegotiated {
+		err = conn.AuthTLSWithOptionsContext(ctx, c.authTLSOptions)
+		if err != nil {
+			conn.Quit()
+			return nil, err
+		}
+	}
+	// Login in
+	err = conn.LoginContext(ctx, c.username, c.password)
+	if err != nil {
+		conn.Quit()
+		return nil, err
+	}
+	if c.compression {
+		err = conn.EnableCompressionContext(ctx, c.compressionLevel)
+		if err != nil {
+			conn.Quit()
+			return nil, err
+		}
+	}
+	// Change to directory of the main connection
+	err = conn.ChangeDirContext(ctx, dirctory)
+	if err != nil {
+		conn.Quit()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ParallelRetr issues RETR FTP commands on several connections to fetch the
+// specified file from the remote FTP server in segments. The file is split in
+// byte ranges, each connection retrieves one range with RetrFrom and writes
+// it to dst at its offset. The first segment is retrieved with c, the others
+// with additional connections using the settings of c.
+//
+// The size of the file is determined with SIZE, MLST or LIST. Segments are
+// just possible in binary mode.
+func (c *ServerConn) ParallelRetr(path string, dst io.WriterAt, segments int) error {
+	return c.ParallelRetrContext(context.Background(), path, dst, segments)
+}
+
+// ParallelRetrContext is like ParallelRetr but with a context.
+func (c *ServerConn) ParallelRetrContext(ctx context.Context, path string, dst io.WriterAt, segments int) error {
+	if c.transferType != ftps_qftp_client.TransferTypeBinary {
+		return errors.New("Segmented transfers are just possible in binary mode.")
+	}
+	size, err := c.remoteSize(ctx, path)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+	// At least one byte per segment
+	if segments < 1 {
+		segments = 1
+	} else if uint64(segments) > size {
+		segments = int(size)
+	}
+	currentdirctory, err := c.CurrentDirContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The other segments are canceled, when a segment fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	returnChannel := make(chan error, segments)
+	for i := 0; i < segments; i++ {
+		start := size * uint64(i) / uint64(segments)
+		end := size * uint64(i+1) / uint64(segments)
+		go func(i int) {
+			// The main connection is also used for a segment
+			conn := c
+			if i > 0 {
+				var err error
+				conn, err = c.openParallelConn(ctx, currentdirctory)
+				if err != nil {
+					returnChannel <- err
+					cancel()
+					return
+				}
+				defer conn.Quit()
+			}
+			err := conn.retrSegment(ctx, path, dst, start, end, end == size)
+			returnChannel <- err
+			if err != nil {
+				cancel()
+			}
+		}(i)
+	}
+
+	// The first error is the cause, the others may be caused by the cancellation
+	var firstErr error
+	for i := 0; i < segments; i++ {
+		if err := <-returnChannel; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// retrSegment retrieves the bytes from start to end of the file and writes
+// them to dst. The transfer of a segment, which does not end at the end of
+// the file, is aborted after its last byte.
+func (c *ServerConn) retrSegment(ctx context.Context, path string, dst io.WriterAt, start uint64, end uint64, last bool) error {
+	r, err := c.RetrFromContext(ctx, path, start)
+	if err != nil {
+		return err
+	}
+
+	w := io.NewOffsetWriter(dst, int64(start))
+	var n int64
+	if last {
+		n, err = io.Copy(w, r)
+	} else {
+		n, err = io.CopyN(w, r, int64(end-start))
+	}
+	if err == nil && n < int64(end-start) {
+		err = errors.New("The file " + path + " on the server is shorter than expected.")
+	} else if err == io.EOF {
+		err = errors.New("The file " + path + " on the server is shorter than expected.")
+	}
+	if err != nil {
+		r.Close()
+		return err
+	}
+	return r.Close()
+}
+
+// ParallelStor issues STOR FTP commands on several connections to store the
+// content of src with the given size in the specified file on the remote FTP
+// server. The content is split in byte ranges, each connection stores one
+// range with StorFrom at its offset. The first segment is stored with c,
+// the others with additional connections using the settings of c.
+//
+// Segments require REST STREAM (RFC 3659) and binary mode, otherwise or if the
+// server rejects an offset beyond the end of the file, the whole content is
+// stored with c.
+func (c *ServerConn) ParallelStor(src io.ReaderAt, size int64, remote string, segments int) error {
+	return c.ParallelStorContext(context.Background(), src, size, remote, segments)
+}
+
+// ParallelStorContext is like ParallelStor but with a context.
+func (c *ServerConn) ParallelStorContext(ctx context.Context, src io.ReaderAt, size int64, remote string, segments int) error {
+	// At least one byte per segment
+	if int64(segments) > size {
+		segments = int(size)
+	}
+	if segments <= 1 || c.features["REST"] != "STREAM" || c.transferType != ftps_qftp_client.TransferTypeBinary {
+		return c.StorContext(ctx, remote, io.NewSectionReader(src, 0, size))
+	}
+	currentdirctory, err := c.CurrentDirContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The file is created before the other segments are stored, STOR
+	// truncates an existing file
+	segmentEnd := size / int64(segments)
+	conn, _, err := c.cmdDataConnFrom(ctx, 0, "STOR %s", remote)
+	if err != nil {
+		return err
+	}
+
+	// The other segments are canceled, when a segment fails
+	segmentCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	returnChannel := make(chan error, segments)
+	go func() {
+		_, err := c.storData(segmentCtx, conn, io.NewSectionReader(src, 0, segmentEnd), nil)
+		returnChannel <- err
+		if err != nil {
+			cancel()
+		}
+	}()
+	for i := 1; i < segments; i++ {
+		start := size * int64(i) / int64(segments)
+		end := size * int64(i+1) / int64(segments)
+		go func() {
+			parallelConn, err := c.openParallelConn(segmentCtx, currentdirctory)
+			if err == nil {
+				defer parallelConn.Quit()
+				err = parallelConn.StorFromContext(segmentCtx, remote, io.NewSectionReader(src, start, end-start), uint64(start))
+			}
+			returnChannel <- err
+			if err != nil {
+				cancel()
+			}
+		}()
+	}
+
+	// The first error is the cause, the others may be caused by the cancellation
+	var firstErr error
+	for i := 0; i < segments; i++ {
+		if err := <-returnChannel; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if _, ok := firstErr.(*restartError); ok {
+		return c.StorContext(ctx, remote, io.NewSectionReader(src, 0, size))
+	} else if protoErr, ok := firstErr.(*textproto.Error); ok && protoErr.Code == StatusInvalidRestart {
+		return c.StorContext(ctx, remote, io.NewSectionReader(src, 0, size))
+	} else if firstErr != nil {
+		return firstErr
+	}
+
+	// The segments are not verified, but the whole file
+	h := c.newVerificationHash(0)
+	if h == nil {
+		return nil
+	}
+	_, err = io.Copy(h, io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return err
+	}
+	return c.verifyTransfer(ctx, remote, h)
+}
+
 // Stores a file at the server within a parallel transfer.
 func (c *ServerConn) parallelStorTask(task TransferTask) error {
+	if task.resume {
+		err := c.ResumeStor(task.localpath, task.remotepath)
+		if _, ok := err.(*ftps_qftp_client.ChecksumError); ok {
+			return err
+		} else if err != nil {
+			return errors.New("Error while writing file " + task.localpath + " to server. " + err.Error())
+		}
+		return nil
+	}
+
 	file, err := os.Open(task.localpath)
 	defer file.Close()
 	if err != nil {
@@ -86,7 +321,9 @@ func (c *ServerConn) parallelStorTask(task TransferTask) error {
 	}
 
 	err = c.Stor(task.remotepath, file)
-	if err != nil {
+	if _, ok := err.(*ftps_qftp_client.ChecksumError); ok {
+		return err
+	} else if err != nil {
 		return errors.New("Error while writing file " + task.localpath + " to server. " + err.Error())
 	}
 	return nil
@@ -94,6 +331,10 @@ func (c *ServerConn) parallelStorTask(task TransferTask) error {
 
 // Receives a file at the server within a parallel transfer.
 func (c *ServerConn) parallelRetrTask(task TransferTask) error {
+	if task.resume {
+		return c.ResumeRetr(task.remotepath, task.localpath)
+	}
+
 	// Check if file already exists at client
 	if _, err := os.Stat(task.localpath); os.IsExist(err) {
 		return errors.New("File with this name already exists in local folder.")
@@ -123,8 +364,351 @@ func (c *ServerConn) parallelRetrTask(task TransferTask) error {
 
 	// Finalize retrieve of the file
 	err = reader.Close()
-	if err != nil {
+	if _, ok := err.(*ftps_qftp_client.ChecksumError); ok {
+		return err
+	} else if err != nil {
 		return errors.New(" Error while closing reader from server. " + err.Error())
 	}
 	return nil
 }
+
+// DownloadDir retrieves the directory tree remoteDir from the remote FTP
+// server and stores it in localDir. The tree is walked with
+// ftps_qftp_client.Walk and the directories are created locally, the files
+// are retrieved with MultipleTransfer on opts.Parallel connections.
+// Links on the server are skipped, because the type of their targets is unknown.
+func (c *ServerConn) DownloadDir(remoteDir string, localDir string, opts ftps_qftp_client.DirTransferOptions) error {
+	tasks, err := c.downloadTasks(remoteDir, localDir, opts.Resume)
+	if err != nil || len(tasks) == 0 {
+		return err
+	}
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	return c.MultipleTransfer(tasks, opts.Parallel)
+}
+
+// downloadTasks walks the directory tree remoteDir, creates the directories
+// in localDir and returns the tasks to retrieve the files.
+func (c *ServerConn) downloadTasks(remoteDir string, localDir string, resume bool) ([]TransferTask, error) {
+	var tasks []TransferTask
+	localDirs := make(map[string]string) // local directories by their remote paths
+	err := ftps_qftp_client.WalkContext(context.Background(), c, remoteDir, ftps_qftp_client.WalkOptions{}, func(remotepath string, entry *ftps_qftp_client.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		localpath := localDir
+		if remotepath != remoteDir {
+			localpath = filepath.Join(localDirs[pathpkg.Dir(remotepath)], entry.FileName())
+		} else if entry.Type == ftps_qftp_client.EntryTypeFile {
+			return errors.New(remoteDir + " is not a directory.")
+		}
+
+		switch entry.Type {
+		case ftps_qftp_client.EntryTypeFolder:
+			err = os.MkdirAll(localpath, 0755)
+			if err != nil {
+				return errors.New("Error while creating the local directory. " + err.Error())
+			}
+			localDirs[pathpkg.Clean(remotepath)] = localpath
+		case ftps_qftp_client.EntryTypeFile:
+			if resume {
+				tasks = append(tasks, NewResumeTransferTask(Retrieve, localpath, remotepath))
+			} else {
+				tasks = append(tasks, NewTransferTask(Retrieve, localpath, remotepath))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// UploadDir stores the local directory tree localDir in remoteDir on the
+// remote FTP server. The directories are created with MakeDirAll, the files
+// are stored with MultipleTransfer on opts.Parallel connections.
+// Symbolic links are skipped or followed according to opts.Symlinks.
+func (c *ServerConn) UploadDir(localDir string, remoteDir string, opts ftps_qftp_client.DirTransferOptions) error {
+	err := c.MakeDirAll(remoteDir)
+	if err != nil {
+		return err
+	}
+	parents := make(map[string]bool)
+	tasks, err := c.uploadTasks(localDir, remoteDir, opts, parents)
+	if err != nil || len(tasks) == 0 {
+		return err
+	}
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	return c.MultipleTransfer(tasks, opts.Parallel)
+}
+
+// uploadTasks reads the local directory tree localDir recursively, creates
+// the directories in remoteDir and returns the tasks to store the files.
+// parents contains the real paths of the directories above localDir to detect
+// loops of followed links.
+func (c *ServerConn) uploadTasks(localDir string, remoteDir string, opts ftps_qftp_client.DirTransferOptions, parents map[string]bool) ([]TransferTask, error) {
+	realDir, err := filepath.EvalSymlinks(localDir)
+	if err != nil {
+		return nil, err
+	}
+	if parents[realDir] {
+		// a link to a parent directory
+		return nil, nil
+	}
+	parents[realDir] = true
+	defer delete(parents, realDir)
+
+	infos, err := ioutil.ReadDir(localDir)
+	if err != nil {
+		return nil, errors.New("Error while reading the local directory. " + err.Error())
+	}
+
+	var tasks []TransferTask
+	for _, info := range infos {
+		localpath := filepath.Join(localDir, info.Name())
+		remotepath := pathpkg.Join(remoteDir, info.Name())
+		if info.Mode()&os.ModeSymlink != 0 {
+			if opts.Symlinks != ftps_qftp_client.FollowSymlinks {
+				continue
+			}
+			info, err = os.Stat(localpath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if info.IsDir() {
+			err = c.makeDirIfMissing(context.Background(), remotepath)
+			if err != nil {
+				return nil, err
+			}
+			subtasks, err := c.uploadTasks(localpath, remotepath, opts, parents)
+			if err != nil {
+				return nil, err
+			}
+			tasks = append(tasks, subtasks...)
+		} else if info.Mode().IsRegular() {
+			if opts.Resume {
+				tasks = append(tasks, NewResumeTransferTask(Store, localpath, remotepath))
+			} else {
+				tasks = append(tasks, NewTransferTask(Store, localpath, remotepath))
+			}
+		}
+	}
+	return tasks, nil
+}
+
+// RemoveAll removes the specified file or directory tree from the remote FTP
+// server. The tree is listed with ListMachine, the files and links are
+// deleted with DELE and the directories with RMD after their content.
+// The paths, which could not be removed, are returned in a
+// *ftps_qftp_client.RemoveAllError.
+func (c *ServerConn) RemoveAll(path string) error {
+	return c.RemoveAllParallelContext(context.Background(), path, 1)
+}
+
+// RemoveAllContext is like RemoveAll but with a context.
+func (c *ServerConn) RemoveAllContext(ctx context.Context, path string) error {
+	return c.RemoveAllParallelContext(ctx, path, 1)
+}
+
+// RemoveAllParallel is like RemoveAll, but deletes the files concurrently on
+// nrParallel connections including c.
+func (c *ServerConn) RemoveAllParallel(path string, nrParallel int) error {
+	return c.RemoveAllParallelContext(context.Background(), path, nrParallel)
+}
+
+// RemoveAllParallelContext is like RemoveAllParallel but with a context.
+func (c *ServerConn) RemoveAllParallelContext(ctx context.Context, path string, nrParallel int) error {
+	// A file or link is deleted directly
+	if c.DeleteContext(ctx, path) == nil {
+		return nil
+	}
+	files, dirs, err := c.listTree(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	removeErr := &ftps_qftp_client.RemoveAllError{}
+	c.deleteFiles(ctx, files, nrParallel, removeErr)
+	// The directories are listed after their content
+	for _, dir := range dirs {
+		err = c.RemoveDirContext(ctx, dir)
+		if err != nil {
+			removeErr.Add(dir, err)
+		}
+	}
+	if len(removeErr.Paths) > 0 {
+		return removeErr
+	}
+	return nil
+}
+
+// listTree walks the tree root. It returns the files and links and the
+// directories, which are listed after their subdirectories.
+func (c *ServerConn) listTree(ctx context.Context, root string) (files []string, dirs []string, err error) {
+	err = ftps_qftp_client.WalkContext(ctx, c, root, ftps_qftp_client.WalkOptions{}, func(path string, entry *ftps_qftp_client.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type == ftps_qftp_client.EntryTypeFolder {
+			dirs = append(dirs, path)
+		} else {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// The subdirectories are walked after their parents
+	for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+	}
+	return files, dirs, nil
+}
+
+// deleteFiles deletes the files on nrParallel connections including c and
+// adds the failed deletions to removeErr.
+func (c *ServerConn) deleteFiles(ctx context.Context, files []string, nrParallel int, removeErr *ftps_qftp_client.RemoveAllError) {
+	currentdirctory := ""
+	if nrParallel > 1 && len(files) > 1 {
+		var err error
+		currentdirctory, err = c.CurrentDirContext(ctx)
+		if err != nil {
+			// The files are deleted with c
+			nrParallel = 1
+		}
+	}
+
+	fileChannel := make(chan string, len(files))
+	for _, file := range files {
+		fileChannel <- file
+	}
+	close(fileChannel)
+
+	var lock sync.Mutex
+	deleteFromChannel := func(conn *ServerConn) {
+		for file := range fileChannel {
+			err := conn.DeleteContext(ctx, file)
+			if err != nil {
+				lock.Lock()
+				removeErr.Add(file, err)
+				lock.Unlock()
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i < nrParallel && i < len(files); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := c.openParallelConn(ctx, currentdirctory)
+			if err != nil {
+				// The files are deleted by the other connections
+				return
+			}
+			defer conn.Quit()
+			deleteFromChannel(conn)
+		}()
+	}
+	// The main connection is also used
+	deleteFromChannel(c)
+	wg.Wait()
+}
+
+// Sync synchronizes the local tree localDir with the tree remoteDir on the
+// remote FTP server according to opts, see ftps_qftp_client.PlanSync.
+// The directories are created first, then the files are transferred with
+// MultipleTransfer on opts.Parallel connections and the extraneous files are
+// removed. The modification time of a transferred file is set on the copy,
+// if the server supports MFMT.
+//
+// The returned report contains the planned actions and the errors of their
+// execution. Conflicts are only reported.
+func (c *ServerConn) Sync(localDir string, remoteDir string, opts ftps_qftp_client.SyncOptions) (*ftps_qftp_client.SyncReport, error) {
+	actions, err := ftps_qftp_client.PlanSync(c, localDir, remoteDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	report := &ftps_qftp_client.SyncReport{Actions: actions}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	// The root directories may be missing
+	if report.Count(ftps_qftp_client.SyncUpload) > 0 {
+		err = c.MakeDirAll(remoteDir)
+		if err != nil {
+			return report, err
+		}
+	}
+	if report.Count(ftps_qftp_client.SyncDownload) > 0 {
+		err = os.MkdirAll(localDir, 0755)
+		if err != nil {
+			return report, errors.New("Error while creating the local directory. " + err.Error())
+		}
+	}
+
+	// The actions are sorted, a directory is created before its content
+	var tasks []TransferTask
+	for _, action := range actions {
+		localpath := filepath.Join(localDir, filepath.FromSlash(action.Path))
+		remotepath := pathpkg.Join(remoteDir, action.Path)
+		var err error
+		switch {
+		case action.Kind == ftps_qftp_client.SyncUpload && action.Dir:
+			err = c.MakeDirAll(remotepath)
+		case action.Kind == ftps_qftp_client.SyncDownload && action.Dir:
+			err = os.MkdirAll(localpath, 0755)
+		case action.Kind == ftps_qftp_client.SyncUpload:
+			tasks = append(tasks, NewTransferTask(Store, localpath, remotepath))
+		case action.Kind == ftps_qftp_client.SyncDownload:
+			tasks = append(tasks, NewTransferTask(Retrieve, localpath, remotepath))
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+		}
+	}
+
+	if len(tasks) > 0 {
+		if opts.Parallel < 1 {
+			opts.Parallel = 1
+		}
+		err = c.MultipleTransfer(tasks, opts.Parallel)
+		if multipleErrors, ok := err.(*ftps_qftp_client.MultipleErrors); ok {
+			report.Errors = append(report.Errors, multipleErrors.Errors...)
+		} else if err != nil {
+			report.Errors = append(report.Errors, err)
+		}
+	}
+
+	for _, action := range actions {
+		localpath := filepath.Join(localDir, filepath.FromSlash(action.Path))
+		remotepath := pathpkg.Join(remoteDir, action.Path)
+		var err error
+		switch action.Kind {
+		case ftps_qftp_client.SyncUpload:
+			if !action.Dir {
+				// Not every server supports MFMT
+				c.SetModTime(remotepath, action.ModTime)
+			}
+		case ftps_qftp_client.SyncDownload:
+			if !action.Dir {
+				os.Chtimes(localpath, action.ModTime, action.ModTime)
+			}
+		case ftps_qftp_client.SyncDeleteRemote:
+			err = c.RemoveAll(remotepath)
+		case ftps_qftp_client.SyncDeleteLocal:
+			err = os.RemoveAll(localpath)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,109 @@
+package ftps
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParallelRetr(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21250"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := ioutil.TempFile("", "ftps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	err = c.ParallelRetr("large.bin", dst, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The main connection is usable after the aborted segment
+	err = c.NoOp()
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connections to close
+	mock.Wait()
+
+	data, err := ioutil.ReadFile(dst.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, largeFile) {
+		t.Error("retrieved data differs")
+	}
+
+	retrs := 0
+	for _, command := range mock.commands {
+		if command == "RETR" {
+			retrs++
+		}
+	}
+	if retrs != 4 {
+		t.Errorf("expected 4 RETR commands, got %d", retrs)
+	}
+}
+
+func TestParallelStor(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	for i, inOrderRest := range []bool{false, true} {
+		address := fmt.Sprintf("127.0.0.1:%d", 21251+i)
+		mock := newFtpMock(t, address)
+		mock.inOrderRest = inOrderRest
+		defer mock.Close()
+
+		c, err := Dial(address, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.Login("anonymous", "anonymous")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.ParallelStor(bytes.NewReader(largeFile), int64(len(largeFile)), "backup.tar", 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The main connection is usable after the aborted segments
+		err = c.NoOp()
+		if err != nil {
+			t.Error(err)
+		}
+
+		c.Quit()
+
+		// Wait for the connections to close
+		mock.Wait()
+
+		if !bytes.Equal(mock.stored, largeFile) {
+			t.Errorf("stored data differs, in order REST %v", inOrderRest)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package ftps
 
 import (
 	"github.com/attenberger/ftps_qftp-client"
+	"os"
 	"testing"
 	"time"
 )
@@ -94,3 +95,52 @@ func TestParseUnsupportedListLine(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRFC3659Facts(t *testing.T) {
+	line := "modify=20150813175250.123;perm=adfr;size=951;type=file;unique=119FBB87UE;UNIX.group=0;UNIX.mode=0644;UNIX.owner=0; welcome.msg"
+	entry, err := parseRFC3659ListLine(line)
+	if err != nil {
+		t.Fatalf("parseRFC3659ListLine(%v) returned err = %v", line, err)
+	}
+	if entry.Perm != "adfr" {
+		t.Errorf("parseRFC3659ListLine(%v).Perm = '%v', want 'adfr'", line, entry.Perm)
+	}
+	if entry.Unique != "119FBB87UE" {
+		t.Errorf("parseRFC3659ListLine(%v).Unique = '%v', want '119FBB87UE'", line, entry.Unique)
+	}
+	if entry.Mode != os.FileMode(0644) {
+		t.Errorf("parseRFC3659ListLine(%v).Mode = %v, want %v", line, entry.Mode, os.FileMode(0644))
+	}
+	if entry.Facts["unix.owner"] != "0" {
+		t.Errorf("parseRFC3659ListLine(%v).Facts[unix.owner] = '%v', want '0'", line, entry.Facts["unix.owner"])
+	}
+	if entry.Time.Unix() != time.Date(2015, time.August, 13, 17, 52, 50, 0, time.UTC).Unix() {
+		t.Errorf("parseRFC3659ListLine(%v).Time = %v", line, entry.Time)
+	}
+
+	line = "type=OS.unix=slink:/usr/bin;perm=r; bin"
+	entry, err = parseRFC3659ListLine(line)
+	if err != nil {
+		t.Fatalf("parseRFC3659ListLine(%v) returned err = %v", line, err)
+	}
+	if entry.Type != ftps_qftp_client.EntryTypeLink {
+		t.Errorf("parseRFC3659ListLine(%v).EntryType = %v, want %v", line, entry.Type, ftps_qftp_client.EntryTypeLink)
+	}
+}
+
+func TestParseUniqueName(t *testing.T) {
+	for _, tt := range []struct {
+		msg  string
+		name string
+	}{
+		{"FILE: upload.1", "upload.1"},
+		{"Opening BINARY mode data connection for FILE: ftp0042", "ftp0042"},
+		{"Transfer complete (unique file name:upload.2).", "upload.2"},
+		{"Ok to send data.\nFILE: a b.txt", "a b.txt"},
+		{"Transfer complete.", ""},
+	} {
+		if name := parseUniqueName(tt.msg); name != tt.name {
+			t.Errorf("parseUniqueName(%q) = %q, want %q", tt.msg, name, tt.name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package ftps
+
+import (
+	"bytes"
+	"github.com/attenberger/ftps_qftp-client"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpprogress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	address := "127.0.0.1:21259"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lock sync.Mutex
+	var reports []ftps_qftp_client.Progress
+	c.SetProgressFunc(func(progress ftps_qftp_client.Progress) {
+		lock.Lock()
+		reports = append(reports, progress)
+		lock.Unlock()
+	})
+
+	r, err := c.Retr("large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(ioutil.Discard, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := reports[len(reports)-1]
+	if !last.Finished || last.Err != nil || last.Done != int64(len(largeFile)) || last.Total != int64(len(largeFile)) {
+		t.Errorf("unexpected last report of Retr: %+v", last)
+	}
+
+	err = c.StorFrom("upload.txt", bytes.NewReader([]byte("data")), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last = reports[len(reports)-1]
+	if !last.Finished || last.Done != 7 || last.Total != 7 || last.Job != nil {
+		t.Errorf("unexpected last report of StorFrom: %+v", last)
+	}
+
+	reports = nil
+	tasks := []TransferTask{
+		NewTransferTask(Retrieve, filepath.Join(dir, "large.bin"), "large.bin"),
+		NewTransferTask(Retrieve, filepath.Join(dir, "a.txt"), "tree/a.txt"),
+	}
+	err = c.MultipleTransfer(tasks, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	finished := 0
+	for _, report := range reports {
+		if report.Job == nil || report.Job.Files != 2 {
+			t.Fatalf("report without the job: %+v", report)
+		}
+		if report.Finished {
+			finished++
+		}
+	}
+	job := reports[len(reports)-1].Job
+	lock.Unlock()
+	if finished != 2 || job.Finished != 2 || job.Done != int64(len(largeFile)+7) || job.Total != job.Done || job.ETA != 0 {
+		t.Errorf("unexpected progress of the job: %+v", job)
+	}
+
+	c.Quit()
+
+	// Wait for the connections to close
+	mock.Wait()
+}
+
+func TestProgressUnknownSize(t *testing.T) {
+	address := "127.0.0.1:21264"
+	mock := newFtpMock(t, address)
+	mock.rejectSize = true
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []ftps_qftp_client.Progress
+	c.SetProgressFunc(func(progress ftps_qftp_client.Progress) {
+		reports = append(reports, progress)
+	})
+
+	r, err := c.Retr("welcome.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(ioutil.Discard, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := reports[len(reports)-1]
+	if !last.Finished || last.Err != nil || last.Done != 7 || last.Total != -1 {
+		t.Errorf("unexpected last report of Retr: %+v", last)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	// The size is not determined with a listing
+	expected := []string{"FEAT", "SIZE", "PASV", "RETR", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
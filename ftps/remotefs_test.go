@@ -0,0 +1,139 @@
+package ftps
+
+import (
+	"bytes"
+	"errors"
+	"github.com/attenberger/ftps_qftp-client"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRemoteFS(t *testing.T) {
+	address := "127.0.0.1:21256"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := ftps_qftp_client.NewRemoteFS(c, "tree")
+	err = fstest.TestFS(fsys, "a.txt", "sub/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fs.ReadFile(fsys, "sub/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "welcome" {
+		t.Errorf("unexpected content %q", data)
+	}
+	_, err = fs.Stat(fsys, "missing.txt")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	c.Quit()
+
+	// Wait for the connections to close
+	mock.Wait()
+}
+
+func TestRemoteFile(t *testing.T) {
+	address := "127.0.0.1:21257"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := c.OpenRemoteFile("large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.SetReadAhead(4096)
+	if f.Size() != int64(len(largeFile)) {
+		t.Errorf("unexpected size %d", f.Size())
+	}
+
+	// Sequential reads use one transfer
+	buf := make([]byte, 3000)
+	for offset := 0; offset < 12000; offset += len(buf) {
+		_, err = io.ReadFull(f, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, largeFile[offset:offset+len(buf)]) {
+			t.Fatalf("unexpected data at %d", offset)
+		}
+	}
+
+	// Seeking away aborts the transfer
+	_, err = f.Seek(-100, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, largeFile[len(largeFile)-100:]) {
+		t.Errorf("unexpected data at the end: %v", data)
+	}
+
+	n, err := f.ReadAt(buf[:10], 500000)
+	if err != nil || n != 10 || !bytes.Equal(buf[:10], largeFile[500000:500010]) {
+		t.Errorf("unexpected ReadAt: %d %v", n, err)
+	}
+	// Served from the window
+	n, err = f.ReadAt(buf[:10], 500100)
+	if err != nil || n != 10 || !bytes.Equal(buf[:10], largeFile[500100:500110]) {
+		t.Errorf("unexpected ReadAt: %d %v", n, err)
+	}
+	n, err = f.ReadAt(buf, int64(len(largeFile)-10))
+	if err != io.EOF || n != 10 {
+		t.Errorf("expected io.EOF after 10 bytes, got %d %v", n, err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection is usable after the file is closed
+	err = c.NoOp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connections to close
+	mock.Wait()
+
+	retrieved := 0
+	for _, command := range mock.commands {
+		if command == "RETR" {
+			retrieved++
+		}
+	}
+	if retrieved != 4 {
+		t.Errorf("expected 4 transfers, got %d: %v", retrieved, mock.commands)
+	}
+}
@@ -0,0 +1,150 @@
+package ftps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	dir, err := ioutil.TempDir("", "ftps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	upload := filepath.Join(dir, "upload.csv")
+	download := filepath.Join(dir, "download.csv")
+	err = ioutil.WriteFile(upload, []byte("0123456789"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(download, []byte("0123"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := "127.0.0.1:21228"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An interrupted upload
+	err = c.Stor("report.csv", strings.NewReader("01234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.ResumeStor(upload, "report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.ResumeRetr("report.csv", download)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing to transfer
+	err = c.ResumeRetr("report.csv", download)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	if string(mock.stored) != "0123456789" {
+		t.Errorf("unexpected stored data: %q", mock.stored)
+	}
+	data, err := ioutil.ReadFile(download)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "0123456789" {
+		t.Errorf("unexpected downloaded data: %q", data)
+	}
+
+	expected := []string{"FEAT", "PASV", "STOR", "SIZE", "PASV", "REST", "STOR",
+		"SIZE", "PASV", "REST", "RETR", "SIZE", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+
+	// Without REST the whole file is transferred
+	address = "127.0.0.1:21229"
+	mock = newFtpMock(t, address)
+	mock.rejectRest = true
+	defer mock.Close()
+
+	c, err = Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Stor("report.csv", strings.NewReader("01234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.ResumeStor(upload, "report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Quit()
+	mock.Wait()
+
+	if string(mock.stored) != "0123456789" {
+		t.Errorf("unexpected stored data: %q", mock.stored)
+	}
+
+	expected = []string{"FEAT", "PASV", "STOR", "SIZE", "PASV", "REST", "PASV", "STOR", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
+
+func TestResumeRetrMissing(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	dir, err := ioutil.TempDir("", "ftps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	download := filepath.Join(dir, "missing.csv")
+
+	address := "127.0.0.1:21265"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.ResumeRetr("missing.csv", download)
+	if err == nil {
+		t.Error("expected an error for a missing remote file")
+	}
+
+	c.Quit()
+	mock.Wait()
+
+	// The local file is not created
+	if _, err := os.Stat(download); !os.IsNotExist(err) {
+		t.Error("unexpected local file:", err)
+	}
+}
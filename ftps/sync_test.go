@@ -0,0 +1,95 @@
+package ftps
+
+import (
+	"github.com/attenberger/ftps_qftp-client"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ftpsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	address := "127.0.0.1:21258"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ftps_qftp_client.SyncOptions{Mode: ftps_qftp_client.SyncMirrorDownload, Parallel: 2}
+	report, err := c.Sync(dir, "tree", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) > 0 {
+		t.Fatal(report.Errors)
+	}
+	if report.Count(ftps_qftp_client.SyncDownload) != 3 {
+		t.Errorf("expected the download of two files and a directory: %v", report.Actions)
+	}
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "welcome" {
+			t.Errorf("unexpected content of %s: %q", name, data)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(time.Date(2015, time.August, 13, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected modification time of %s: %v", name, info.ModTime())
+		}
+	}
+
+	// The trees are equal except the extraneous file
+	err = ioutil.WriteFile(filepath.Join(dir, "sub", "extra.txt"), []byte("extra"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.DryRun = true
+	opts.DeleteExtraneous = true
+	report, err = c.Sync(dir, "tree", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ftps_qftp_client.SyncAction{{Kind: ftps_qftp_client.SyncDeleteLocal, Path: "sub/extra.txt", Reason: "missing on the server"}}
+	if !reflect.DeepEqual(report.Actions, expected) {
+		t.Errorf("unexpected actions %v", report.Actions)
+	}
+
+	// In the other direction the extra file is uploaded
+	opts.Mode = ftps_qftp_client.SyncBidirectional
+	report, err = c.Sync(dir, "tree", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].Kind != ftps_qftp_client.SyncUpload {
+		t.Errorf("unexpected actions %v", report.Actions)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "sub", "extra.txt")); err != nil {
+		t.Error("the dry run changed the local tree")
+	}
+
+	c.Quit()
+
+	// Wait for the connections to close
+	mock.Wait()
+}
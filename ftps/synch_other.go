@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package ftps
+
+import "net"
+
+// sendUrgent sends data on the TCP connection. Urgent data is not supported
+// on this platform, so the Telnet Synch is sent inline.
+func sendUrgent(conn net.Conn, data []byte) error {
+	_, err := conn.Write(data)
+	return err
+}
@@ -0,0 +1,33 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package ftps
+
+import (
+	"net"
+	"syscall"
+)
+
+// sendUrgent sends data on the TCP connection with the last byte marked as
+// urgent (out-of-band), as required for the Telnet Synch.
+func sendUrgent(conn net.Conn, data []byte) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		_, err := conn.Write(data)
+		return err
+	}
+
+	rawConn, err := tcpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sendErr error
+	err = rawConn.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendto(int(fd), data, syscall.MSG_OOB, nil)
+		return sendErr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
@@ -0,0 +1,376 @@
+package ftps
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/attenberger/ftps_qftp-client"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// generateTestCertificate creates a self-signed server certificate and writes
+// it to a file in dir.
+func generateTestCertificate(t *testing.T, dir string) (tls.Certificate, string) {
+	certificate, _ := createTestCertificate(t, x509.ExtKeyUsageServerAuth)
+
+	certfile := filepath.Join(dir, "server.crt")
+	err := ioutil.WriteFile(certfile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate, certfile
+}
+
+// generateTestClientCertificate creates a self-signed client certificate and
+// writes it and the private key encrypted with password to files in dir.
+func generateTestClientCertificate(t *testing.T, dir string, password string) (*x509.Certificate, string, string) {
+	certificate, key := createTestCertificate(t, x509.ExtKeyUsageClientAuth)
+
+	certfile := filepath.Join(dir, "client.crt")
+	err := ioutil.WriteFile(certfile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der, []byte(password), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyfile := filepath.Join(dir, "client.key")
+	err = ioutil.WriteFile(keyfile, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed, certfile, keyfile
+}
+
+// createTestCertificate creates a self-signed certificate for localhost
+func createTestCertificate(t *testing.T, usage x509.ExtKeyUsage) (tls.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, key
+}
+
+func TestImplicitTLS(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	certificate, certfile := generateTestCertificate(t, t.TempDir())
+	address := "127.0.0.1:21221"
+	mock := newFtpMockTLS(t, address, &tls.Config{Certificates: []tls.Certificate{certificate}})
+	defer mock.Close()
+
+	c, err := DialWithConfig(address, DialConfig{Timeout: 5 * time.Second, TLS: caFile(certfile), Implicit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.Retr("welcome.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(data) != "welcome" {
+		t.Errorf("unexpected data: %q", data)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = c.AuthTLS(); err == nil {
+		t.Error("AUTH TLS on an implicit FTPS connection should fail")
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	expected := []string{"FEAT", "USER", "PASS", "PBSZ", "PROT P", "TYPE", "FEAT", "PASV", "RETR", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
+
+func TestTLSSessionReuse(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	certificate, certfile := generateTestCertificate(t, t.TempDir())
+	address := "127.0.0.1:21222"
+	mock := newFtpMockTLS(t, address, &tls.Config{Certificates: []tls.Certificate{certificate}})
+	mock.requireSessionReuse = true
+	defer mock.Close()
+
+	c, err := DialWithConfig(address, DialConfig{Timeout: 5 * time.Second, TLS: caFile(certfile), Implicit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every data connection must resume the session
+	for i := 0; i < 2; i++ {
+		r, err := c.Retr("welcome.msg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(data) != "welcome" {
+			t.Errorf("unexpected data: %q", data)
+		}
+		err = r.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+}
+
+// caFile trusts the certificate in certfile
+func caFile(certfile string) ftps_qftp_client.TLSOptions {
+	return ftps_qftp_client.TLSOptions{Trust: ftps_qftp_client.TrustCAFile, CAFile: certfile}
+}
+
+func TestCertificateVerification(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	certificate, certfile := generateTestCertificate(t, t.TempDir())
+	fingerprint := ftps_qftp_client.CertificateFingerprint(certificate.Certificate[0])
+
+	tests := []struct {
+		options ftps_qftp_client.TLSOptions
+		kind    ftps_qftp_client.CertificateErrorKind
+		ok      bool
+	}{
+		{caFile(certfile), 0, true},
+		{ftps_qftp_client.TLSOptions{Trust: ftps_qftp_client.TrustPinned, Pins: []string{strings.ToUpper(fingerprint)}}, 0, true},
+		{ftps_qftp_client.TLSOptions{Trust: ftps_qftp_client.TrustInsecure}, 0, true},
+		{ftps_qftp_client.TLSOptions{Trust: ftps_qftp_client.TrustSystemRoots}, ftps_qftp_client.CertificateUnknownAuthority, false},
+		{ftps_qftp_client.TLSOptions{Trust: ftps_qftp_client.TrustPinned, Pins: []string{"00:11"}}, ftps_qftp_client.CertificatePinMismatch, false},
+	}
+
+	for i, test := range tests {
+		address := "127.0.0.1:" + strconv.Itoa(21230+i)
+		mock := newFtpMockTLS(t, address, &tls.Config{Certificates: []tls.Certificate{certificate}})
+
+		c, err := DialWithConfig(address, DialConfig{Timeout: 5 * time.Second, TLS: test.options, Implicit: true})
+		if test.ok {
+			if err != nil {
+				t.Errorf("test %d: %s", i, err)
+			} else {
+				c.Quit()
+			}
+		} else {
+			var certErr *ftps_qftp_client.CertificateError
+			if !errors.As(err, &certErr) {
+				t.Errorf("test %d: expected CertificateError, got %v", i, err)
+			} else if certErr.Kind != test.kind || certErr.Fingerprint != fingerprint {
+				t.Errorf("test %d: unexpected error: %s", i, certErr)
+			}
+		}
+		mock.Wait()
+		mock.Close()
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	dir := t.TempDir()
+	certificate, certfile := generateTestCertificate(t, dir)
+	clientCertificate, clientCertfile, clientKeyfile := generateTestClientCertificate(t, dir, "secret")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCertificate)
+
+	address := "127.0.0.1:21223"
+	mock := newFtpMockTLS(t, address, &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	defer mock.Close()
+
+	options := caFile(certfile)
+	options.CertFile = clientCertfile
+	options.KeyFile = clientKeyfile
+	options.KeyPassword = "secret"
+	c, err := DialWithConfig(address, DialConfig{Timeout: 5 * time.Second, TLS: options, Implicit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Login("anonymous", "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The data connection also requires the client certificate
+	r, err := c.Retr("welcome.msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	if string(data) != "welcome" {
+		t.Errorf("unexpected data: %q", data)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	options.KeyPassword = "wrong"
+	_, err = DialWithConfig(address, DialConfig{Timeout: 5 * time.Second, TLS: options, Implicit: true})
+	if err == nil {
+		t.Error("dial with a wrong key password should fail")
+	}
+}
+
+func TestAuthTLSOptions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	certificate, certfile := generateTestCertificate(t, t.TempDir())
+
+	tests := []struct {
+		options  AuthTLSOptions
+		implicit bool
+		expected []string
+	}{
+		{AuthTLSOptions{}, false,
+			[]string{"FEAT", "AUTH", "PBSZ", "PROT P", "USER", "PASS", "TYPE", "FEAT", "PASV", "RETR", "QUIT"}},
+		{AuthTLSOptions{Protection: ProtectionClear}, false,
+			[]string{"FEAT", "AUTH", "PBSZ", "PROT C", "USER", "PASS", "TYPE", "FEAT", "PASV", "RETR", "QUIT"}},
+		{AuthTLSOptions{ClearCommandChannel: true}, false,
+			[]string{"FEAT", "AUTH", "PBSZ", "PROT P", "USER", "PASS", "CCC", "TYPE", "FEAT", "PASV", "RETR", "QUIT"}},
+		{AuthTLSOptions{Protection: ProtectionClear, ClearCommandChannel: true}, false,
+			[]string{"FEAT", "AUTH", "PBSZ", "PROT C", "USER", "PASS", "CCC", "TYPE", "FEAT", "PASV", "RETR", "QUIT"}},
+		{AuthTLSOptions{Protection: ProtectionClear}, true,
+			[]string{"FEAT", "USER", "PASS", "PBSZ", "PROT C", "TYPE", "FEAT", "PASV", "RETR", "QUIT"}},
+		{AuthTLSOptions{ClearCommandChannel: true}, true,
+			[]string{"FEAT", "USER", "PASS", "PBSZ", "PROT P", "CCC", "TYPE", "FEAT", "PASV", "RETR", "QUIT"}},
+	}
+
+	for i, test := range tests {
+		address := "127.0.0.1:" + strconv.Itoa(21240+i)
+		mock := newFtpMockConfig(t, address, &tls.Config{Certificates: []tls.Certificate{certificate}}, test.implicit)
+
+		config := DialConfig{Timeout: 5 * time.Second, TLS: caFile(certfile), Implicit: test.implicit}
+		if test.implicit {
+			config.ImplicitTLS = test.options
+		}
+		c, err := DialWithConfig(address, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !test.implicit {
+			err = c.AuthTLSWithOptions(test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = c.Login("anonymous", "anonymous")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := c.Retr("welcome.msg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+		}
+		if string(data) != "welcome" {
+			t.Errorf("test %d: unexpected data: %q", i, data)
+		}
+		err = r.Close()
+		if err != nil {
+			t.Error(err)
+		}
+
+		c.Quit()
+
+		// Wait for the connection to close
+		mock.Wait()
+		mock.Close()
+
+		if !reflect.DeepEqual(mock.commands, test.expected) {
+			t.Error("test", i, "unexpected sequence of commands:", mock.commands, "expected:", test.expected)
+		}
+	}
+}
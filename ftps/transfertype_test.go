@@ -0,0 +1,55 @@
+package ftps
+
+import (
+	"github.com/attenberger/ftps_qftp-client"
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestTransferTypeASCII(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21224"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.SetTransferType(ftps_qftp_client.TransferTypeASCII)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.Retr("text.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	if runtime.GOOS != "windows" && string(data) != "line1\nline2\n" {
+		t.Errorf("unexpected data: %q", data)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	expected := []string{"FEAT", "TYPE", "PASV", "RETR", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
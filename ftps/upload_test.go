@@ -0,0 +1,49 @@
+package ftps
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppendAndStorUnique(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	address := "127.0.0.1:21227"
+	mock := newFtpMock(t, address)
+	defer mock.Close()
+
+	c, err := Dial(address, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := c.StorUnique(strings.NewReader("date;value\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "upload.1" {
+		t.Errorf("unexpected name %q", name)
+	}
+
+	err = c.Append(name, strings.NewReader("2018-01-01;42\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Quit()
+
+	// Wait for the connection to close
+	mock.Wait()
+
+	if string(mock.stored) != "date;value\n2018-01-01;42\n" {
+		t.Errorf("unexpected stored data: %q", mock.stored)
+	}
+
+	expected := []string{"FEAT", "PASV", "STOU", "PASV", "APPE", "QUIT"}
+	if !reflect.DeepEqual(mock.commands, expected) {
+		t.Fatal("unexpected sequence of commands:", mock.commands, "expected:", expected)
+	}
+}
@@ -0,0 +1,130 @@
+package ftps_qftp_client
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"strings"
+)
+
+// HashAlgorithm names a hash algorithm like the HASH command
+// (draft-bryan-ftpext-hash).
+type HashAlgorithm string
+
+// The supported hash algorithms
+const (
+	HashSHA256 HashAlgorithm = "SHA-256"
+	HashSHA1   HashAlgorithm = "SHA-1"
+	HashMD5    HashAlgorithm = "MD5"
+	HashCRC32  HashAlgorithm = "CRC32"
+)
+
+// HashAlgorithms lists the supported algorithms from the strongest to the
+// weakest. Without HASH a server is asked in this order by Hash without an
+// algorithm.
+var HashAlgorithms = []HashAlgorithm{HashSHA256, HashSHA1, HashMD5, HashCRC32}
+
+// New returns a new hash.Hash computing the checksum of the algorithm.
+func (algorithm HashAlgorithm) New() (hash.Hash, error) {
+	switch algorithm {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA1:
+		return sha1.New(), nil
+	case HashMD5:
+		return md5.New(), nil
+	case HashCRC32:
+		return crc32.NewIEEE(), nil
+	}
+	return nil, errors.New("Unknown hash algorithm " + string(algorithm) + ".")
+}
+
+// LegacyCommand returns the command of the algorithm used by servers without
+// HASH, e.g. XSHA256.
+func (algorithm HashAlgorithm) LegacyCommand() string {
+	switch algorithm {
+	case HashSHA256:
+		return "XSHA256"
+	case HashSHA1:
+		return "XSHA1"
+	case HashMD5:
+		return "XMD5"
+	case HashCRC32:
+		return "XCRC"
+	}
+	return ""
+}
+
+// NormalizeHash returns the hex encoded checksum in lower case, a CRC32 is
+// padded with zeros to 8 digits.
+func NormalizeHash(algorithm HashAlgorithm, checksum string) string {
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if algorithm == HashCRC32 && len(checksum) < 8 {
+		checksum = strings.Repeat("0", 8-len(checksum)) + checksum
+	}
+	return checksum
+}
+
+// ChecksumError is returned, when the checksum of the file on the server
+// differs from the checksum of the transferred data.
+type ChecksumError struct {
+	Path      string
+	Algorithm HashAlgorithm
+	Local     string // checksum of the transferred data
+	Remote    string // checksum of the file on the server
+}
+
+func (e *ChecksumError) Error() string {
+	return "Checksum mismatch for " + e.Path + ", " + string(e.Algorithm) + " of the transferred data is " +
+		e.Local + " and of the file on the server " + e.Remote + "."
+}
+
+// HashUnsupportedError is returned, when the server can not compute the
+// checksum of a file, because it implements neither HASH nor the legacy
+// command of the algorithm. The verification of transfers is skipped in this
+// case.
+type HashUnsupportedError struct {
+	Algorithm HashAlgorithm // empty, if none of the legacy commands is implemented
+}
+
+func (e *HashUnsupportedError) Error() string {
+	if e.Algorithm == "" {
+		return "The server does not support a hash command."
+	}
+	return "The server does not support the hash algorithm " + string(e.Algorithm) + "."
+}
+
+// MultipleErrors collects the errors of the transfers of multiple files.
+type MultipleErrors struct {
+	Errors []error
+}
+
+func (e *MultipleErrors) Error() string {
+	message := ""
+	for _, err := range e.Errors {
+		message = message + "\n" + err.Error()
+	}
+	return message
+}
+
+// Unwrap returns the collected errors, so errors.As finds e.g. a ChecksumError.
+func (e *MultipleErrors) Unwrap() []error {
+	return e.Errors
+}
+
+// HashFeature parses the HASH feature listed by FEAT, e.g. "SHA-256*;SHA-1;MD5".
+// It returns whether the algorithm is supported and whether it is the
+// selected one, marked with *.
+func HashFeature(feature string, algorithm HashAlgorithm) (supported bool, selected bool) {
+	for _, name := range strings.Split(feature, ";") {
+		name = strings.TrimSpace(name)
+		current := strings.HasSuffix(name, "*")
+		if strings.EqualFold(strings.TrimSuffix(name, "*"), string(algorithm)) {
+			return true, current
+		}
+	}
+	return false, false
+}
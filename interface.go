@@ -1,6 +1,10 @@
 package ftps_qftp_client
 
-import "io"
+import (
+	"context"
+	"io"
+	"time"
+)
 
 type ConnectionI interface {
 
@@ -27,6 +31,16 @@ type ConnectionI interface {
 	// List issues a LIST FTP command.
 	List(path string) (entries []*Entry, err error)
 
+	// ListMachine issues a MLSD FTP command, which lists the directory in the
+	// machine-readable format defined in RFC 3659. If the server does not
+	// support MLST, it falls back to List.
+	ListMachine(path string) (entries []*Entry, err error)
+
+	// Stat issues a MLST FTP command, which returns the facts of a single file
+	// or directory. If the server does not support MLST, the entry is searched
+	// in the List of the parent directory.
+	Stat(path string) (*Entry, error)
+
 	// ChangeDir issues a CWD FTP command, which changes the current directory to
 	// the specified path.
 	ChangeDir(path string) error
@@ -40,18 +54,68 @@ type ConnectionI interface {
 	// directory.
 	CurrentDir() (string, error)
 
+	// FileSize issues a SIZE FTP command, which returns the size of the file in
+	// bytes.
+	FileSize(path string) (uint64, error)
+
+	// ModTime issues a MDTM FTP command, which returns the last modification
+	// time of the file.
+	ModTime(path string) (time.Time, error)
+
+	// SetModTime issues a MFMT FTP command, which sets the last modification
+	// time of the file.
+	SetModTime(path string, t time.Time) error
+
+	// Hash returns the hex encoded checksum of the file on the server computed
+	// with the algorithm. HASH is used if the server supports it, otherwise
+	// XSHA256, XSHA1, XMD5 or XCRC. An empty algorithm is SHA-256 with HASH,
+	// without HASH the first implemented of these commands. If the server can
+	// not compute the checksum, *HashUnsupportedError is returned.
+	Hash(path string, algorithm HashAlgorithm) (string, error)
+
+	// SetTransferVerification enables the verification of complete binary
+	// transfers of Retr and Stor with the checksum of the algorithm, a
+	// mismatch is returned as *ChecksumError. An empty algorithm disables it,
+	// it is skipped, if the server does not support the algorithm.
+	SetTransferVerification(algorithm HashAlgorithm) error
+
+	// SetProgressFunc sets the function, which is called with the progress of
+	// the transfers. A nil function disables the reports.
+	SetProgressFunc(fn ProgressFunc)
+
+	// EnableCompression issues a MODE Z FTP command, so the data of the
+	// following transfers and listings is compressed with deflate. The
+	// compression level of the server is set, if level is between 1 and 9.
+	EnableCompression(level int) error
+
+	// DisableCompression issues a MODE S FTP command to transfer the data
+	// uncompressed again.
+	DisableCompression() error
+
+	// SetTransferType issues a TYPE FTP command to set the representation type
+	// of the transferred files. In ASCII mode Retr and Stor convert between
+	// the local newline convention and CRLF. The type is kept after Login.
+	SetTransferType(transferType TransferType) error
+
 	// Retr issues a RETR FTP command to fetch the specified file from the remote
 	// FTP server.
 	//
-	// The retrive must be finialized with FinializeRetr() to cleanup the FTP data connection.
+	// The returned ReadCloser must be closed to cleanup the FTP data connection,
+	// closing it before the end of the file aborts the transfer.
 	Retr(path string) (io.ReadCloser, error)
 
 	// RetrFrom issues a RETR FTP command to fetch the specified file from the remote
 	// FTP server, the server will not send the offset first bytes of the file.
+	// In ASCII mode offset counts the bytes of the NVT-ASCII data, see NVTLength.
 	//
-	// The retrive must be finialized with FinializeRetr() to cleanup the FTP data connection.
+	// The returned ReadCloser must be closed to cleanup the FTP data connection,
+	// closing it before the end of the file aborts the transfer.
 	RetrFrom(path string, offset uint64) (io.ReadCloser, error)
 
+	// OpenRemoteFile opens the specified file on the remote FTP server for
+	// random access with RetrFrom, see RemoteFile.
+	OpenRemoteFile(path string) (*RemoteFile, error)
+
 	// Stor issues a STOR FTP command to store a file to the remote FTP server.
 	// Stor creates the specified file with the content of the io.Reader.
 	//
@@ -65,6 +129,53 @@ type ConnectionI interface {
 	// Hint: io.Pipe() can be used if an io.Writer is required.
 	StorFrom(path string, r io.Reader, offset uint64) error
 
+	// Append issues a APPE FTP command to append the content of the io.Reader
+	// to the specified file on the remote FTP server.
+	Append(path string, r io.Reader) error
+
+	// StorUnique issues a STOU FTP command to store the content of the
+	// io.Reader in a new file with a unique name chosen by the server and
+	// returns the name.
+	StorUnique(r io.Reader) (serverName string, err error)
+
+	// ResumeRetr downloads the file from the remote FTP server to the local
+	// file and retrieves only the missing part, if the local file is shorter.
+	ResumeRetr(remote string, localFile string) error
+
+	// ResumeStor uploads the local file to the remote FTP server and stores
+	// only the missing part, if the file on the server is shorter.
+	ResumeStor(localFile string, remote string) error
+
+	// ParallelRetr fetches the file from the remote FTP server in segments,
+	// which are retrieved in parallel on additional connections and written
+	// to dst at their offsets.
+	ParallelRetr(path string, dst io.WriterAt, segments int) error
+
+	// ParallelStor stores the content of src in the file on the remote FTP
+	// server in segments, which are stored in parallel on additional
+	// connections at their offsets.
+	ParallelStor(src io.ReaderAt, size int64, remote string, segments int) error
+
+	// DownloadDir retrieves the directory tree remoteDir from the remote FTP
+	// server in parallel connections and stores it in localDir.
+	DownloadDir(remoteDir string, localDir string, opts DirTransferOptions) error
+
+	// UploadDir stores the local directory tree localDir in remoteDir on the
+	// remote FTP server in parallel connections.
+	UploadDir(localDir string, remoteDir string, opts DirTransferOptions) error
+
+	// Sync synchronizes the local tree localDir with the tree remoteDir on the
+	// remote FTP server according to opts.
+	Sync(localDir string, remoteDir string, opts SyncOptions) (*SyncReport, error)
+
+	// RemoveAll removes the specified file or directory tree from the remote
+	// FTP server.
+	RemoveAll(path string) error
+
+	// RemoveAllParallel is like RemoveAll, but deletes the files concurrently
+	// on nrParallel connections.
+	RemoveAllParallel(path string, nrParallel int) error
+
 	// Rename renames a file on the remote FTP server.
 	Rename(from, to string) error
 
@@ -76,6 +187,10 @@ type ConnectionI interface {
 	// remote FTP server.
 	MakeDir(path string) error
 
+	// MakeDirAll creates the specified directory on the remote FTP server
+	// together with all missing parent directories.
+	MakeDirAll(path string) error
+
 	// RemoveDir issues a RMD FTP command to remove the specified directory from
 	// the remote FTP server.
 	RemoveDir(path string) error
@@ -91,4 +206,47 @@ type ConnectionI interface {
 
 	// Logout issues a REIN FTP command to logout the current user.
 	Quit() error
+
+	// The following methods are like the ones without the Context suffix.
+	// When ctx is done, the blocked command is interrupted, the data
+	// connection or stream of a running transfer is aborted and the error of
+	// ctx is returned. The connection stays usable for further commands.
+
+	LoginContext(ctx context.Context, user, password string) error
+	AuthTLSContext(ctx context.Context) error
+	FeatContext(ctx context.Context) error
+	NameListContext(ctx context.Context, path string) (entries []string, err error)
+	ListContext(ctx context.Context, path string) (entries []*Entry, err error)
+	ListMachineContext(ctx context.Context, path string) (entries []*Entry, err error)
+	StatContext(ctx context.Context, path string) (*Entry, error)
+	ChangeDirContext(ctx context.Context, path string) error
+	ChangeDirToParentContext(ctx context.Context) error
+	CurrentDirContext(ctx context.Context) (string, error)
+	FileSizeContext(ctx context.Context, path string) (uint64, error)
+	ModTimeContext(ctx context.Context, path string) (time.Time, error)
+	SetModTimeContext(ctx context.Context, path string, t time.Time) error
+	HashContext(ctx context.Context, path string, algorithm HashAlgorithm) (string, error)
+	EnableCompressionContext(ctx context.Context, level int) error
+	DisableCompressionContext(ctx context.Context) error
+	SetTransferTypeContext(ctx context.Context, transferType TransferType) error
+	RetrContext(ctx context.Context, path string) (io.ReadCloser, error)
+	RetrFromContext(ctx context.Context, path string, offset uint64) (io.ReadCloser, error)
+	StorContext(ctx context.Context, path string, r io.Reader) error
+	StorFromContext(ctx context.Context, path string, r io.Reader, offset uint64) error
+	ResumeRetrContext(ctx context.Context, remote string, localFile string) error
+	ResumeStorContext(ctx context.Context, localFile string, remote string) error
+	ParallelRetrContext(ctx context.Context, path string, dst io.WriterAt, segments int) error
+	ParallelStorContext(ctx context.Context, src io.ReaderAt, size int64, remote string, segments int) error
+	AppendContext(ctx context.Context, path string, r io.Reader) error
+	StorUniqueContext(ctx context.Context, r io.Reader) (serverName string, err error)
+	RenameContext(ctx context.Context, from, to string) error
+	DeleteContext(ctx context.Context, path string) error
+	MakeDirContext(ctx context.Context, path string) error
+	MakeDirAllContext(ctx context.Context, path string) error
+	RemoveAllContext(ctx context.Context, path string) error
+	RemoveAllParallelContext(ctx context.Context, path string, nrParallel int) error
+	RemoveDirContext(ctx context.Context, path string) error
+	NoOpContext(ctx context.Context) error
+	LogoutContext(ctx context.Context) error
+	QuitContext(ctx context.Context) error
 }
@@ -0,0 +1,34 @@
+package ftps_qftp_client
+
+import (
+	"compress/zlib"
+	"io"
+)
+
+// modeZReader decompresses the data of a MODE Z transfer. The zlib header is
+// read with the first Read, so creating the reader does not block.
+type modeZReader struct {
+	r  io.Reader
+	zr io.ReadCloser
+}
+
+// NewModeZReader returns a reader, which decompresses the zlib stream of a
+// MODE Z transfer (draft-preston-ftpext-deflate).
+func NewModeZReader(r io.Reader) io.Reader {
+	return &modeZReader{r: r}
+}
+
+// Read implements the io.Reader interface.
+func (m *modeZReader) Read(p []byte) (int, error) {
+	if m.zr == nil {
+		zr, err := zlib.NewReader(m.r)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		m.zr = zr
+	}
+	return m.zr.Read(p)
+}
@@ -0,0 +1,150 @@
+package ftps_qftp_client
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"hash"
+)
+
+// Object identifiers of the password based encryption of PKCS #5 v2 (RFC 8018)
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// maxPBKDF2Iterations limits the time to derive the key of a private key
+// file, OpenSSL uses 2048 iterations by default.
+const maxPBKDF2Iterations = 10000000
+
+// encryptedPrivateKeyInfo is the content of a PEM block "ENCRYPTED PRIVATE KEY"
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"` // HMAC-SHA1, if it is missing
+}
+
+// decryptPKCS8 decrypts an encrypted PKCS #8 private key and returns the DER
+// encoded unencrypted PKCS #8 key. Only the scheme PBES2 with PBKDF2 and
+// AES-CBC or 3DES-CBC is supported, which is used by OpenSSL since version
+// 1.1. The older PBES1 schemes with DES or RC2 are not supported.
+func decryptPKCS8(der []byte, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.New("Malformed encrypted private key. " + err.Error())
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("Unsupported encryption of the private key " + info.Algorithm.Algorithm.String() + ", only PBES2 is supported.")
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("Malformed encrypted private key. " + err.Error())
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.New("Unsupported key derivation function " + params.KeyDerivationFunc.Algorithm.String() + ", only PBKDF2 is supported.")
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errors.New("Malformed encrypted private key. " + err.Error())
+	}
+
+	if kdfParams.IterationCount < 1 || kdfParams.IterationCount > maxPBKDF2Iterations {
+		return nil, errors.New("Unsupported iteration count of PBKDF2.")
+	}
+
+	var prf func() hash.Hash
+	switch algorithm := kdfParams.PRF.Algorithm; {
+	case len(algorithm) == 0, algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case algorithm.Equal(oidHMACWithSHA224):
+		prf = sha256.New224
+	case algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, errors.New("Unsupported pseudorandom function " + algorithm.String() + " of PBKDF2.")
+	}
+
+	var keyLength int
+	var newCipher func(key []byte) (cipher.Block, error)
+	switch algorithm := params.EncryptionScheme.Algorithm; {
+	case algorithm.Equal(oidAES128CBC):
+		keyLength, newCipher = 16, aes.NewCipher
+	case algorithm.Equal(oidAES192CBC):
+		keyLength, newCipher = 24, aes.NewCipher
+	case algorithm.Equal(oidAES256CBC):
+		keyLength, newCipher = 32, aes.NewCipher
+	case algorithm.Equal(oidDESEDE3CBC):
+		keyLength, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, errors.New("Unsupported cipher " + algorithm.String() + " of the private key.")
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keyLength {
+		return nil, errors.New("Malformed encrypted private key. The key length does not match the cipher.")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New("Malformed encrypted private key. " + err.Error())
+	}
+
+	derivedKey, err := pbkdf2.Key(prf, string(password), kdfParams.Salt, kdfParams.IterationCount, keyLength)
+	if err != nil {
+		return nil, err
+	}
+	block, err := newCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("Malformed encrypted private key. Invalid length of the data.")
+	}
+	key := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(key, info.EncryptedData)
+
+	// A wrong password results in an invalid padding or an invalid key
+	padding := int(key[len(key)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errors.New("Wrong password of the private key.")
+	}
+	for _, b := range key[len(key)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("Wrong password of the private key.")
+		}
+	}
+	key = key[:len(key)-padding]
+	if _, err := x509.ParsePKCS8PrivateKey(key); err != nil {
+		return nil, errors.New("Wrong password of the private key.")
+	}
+	return key, nil
+}
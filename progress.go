@@ -0,0 +1,190 @@
+package ftps_qftp_client
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ProgressInterval is the minimal time between two reports of the progress
+// of a transfer
+const ProgressInterval = 200 * time.Millisecond
+
+// Progress describes the state of a transfer, it is reported to a
+// ProgressFunc.
+type Progress struct {
+	Path     string        // path of the file on the server
+	Done     int64         // transferred bytes including the offset of a resumed transfer
+	Total    int64         // size of the file, -1 if unknown
+	Rate     float64       // bytes per second since the previous report
+	ETA      time.Duration // estimated time until the end of the transfer, -1 if unknown
+	Finished bool          // the transfer is complete or failed, the last report of a transfer
+	Err      error         // error of a finished transfer
+	Job      *JobProgress  // progress of a job with multiple files like MultipleTransfer, nil for single transfers
+}
+
+// JobProgress describes the state of a job with multiple files.
+type JobProgress struct {
+	Files    int           // number of files of the job
+	Finished int           // number of finished transfers
+	Done     int64         // transferred bytes of all files
+	Total    int64         // sum of the known sizes of the started transfers
+	Rate     float64       // sum of the rates of the running transfers
+	ETA      time.Duration // estimated time until the end of the started transfers, -1 if unknown
+}
+
+// ProgressFunc is called with the progress of the transfers. It is called
+// from the goroutine, which reads or writes the data.
+type ProgressFunc func(Progress)
+
+// ProgressReader reports the progress of the data read from a reader to a
+// ProgressFunc at most every ProgressInterval. Finish reports the end of the
+// transfer.
+type ProgressReader struct {
+	r          io.Reader
+	fn         ProgressFunc
+	progress   Progress
+	lastReport time.Time
+	lastDone   int64
+	finished   bool
+}
+
+// NewProgressReader returns a reader, which reports the progress of the
+// transfer of the file path. offset is the number of bytes, which were
+// transferred before, total the size of the file or -1, if it is unknown.
+func NewProgressReader(r io.Reader, path string, offset int64, total int64, fn ProgressFunc) *ProgressReader {
+	p := &ProgressReader{
+		r:          r,
+		fn:         fn,
+		progress:   Progress{Path: path, Done: offset, Total: total, ETA: -1},
+		lastReport: time.Now(),
+		lastDone:   offset,
+	}
+	p.fn(p.progress)
+	return p
+}
+
+// Read implements the io.Reader interface.
+func (p *ProgressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.progress.Done += int64(n)
+	if time.Since(p.lastReport) >= ProgressInterval {
+		p.report()
+	}
+	return n, err
+}
+
+// Finish reports the end of the transfer with its error. Further calls have
+// no effect.
+func (p *ProgressReader) Finish(err error) {
+	if p.finished {
+		return
+	}
+	p.finished = true
+	p.progress.Finished = true
+	p.progress.Err = err
+	p.report()
+}
+
+// report calculates the rate since the previous report and reports the progress
+func (p *ProgressReader) report() {
+	now := time.Now()
+	if elapsed := now.Sub(p.lastReport).Seconds(); elapsed > 0 {
+		p.progress.Rate = float64(p.progress.Done-p.lastDone) / elapsed
+	}
+	p.progress.ETA = estimate(p.progress.Total-p.progress.Done, p.progress.Rate, p.progress.Total >= 0)
+	if p.progress.Finished {
+		p.progress.ETA = 0
+	}
+	p.lastReport = now
+	p.lastDone = p.progress.Done
+	p.fn(p.progress)
+}
+
+// estimate returns the time to transfer the remaining bytes with the rate
+// or -1, if it is unknown.
+func estimate(remaining int64, rate float64, known bool) time.Duration {
+	if !known || rate <= 0 {
+		return -1
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second))
+}
+
+// RemainingLength returns the number of bytes, which can be read from r, or
+// -1 if it is unknown. It is known for files and readers with a Len method
+// like bytes.Reader.
+func RemainingLength(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len())
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		position, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - position
+	case *io.SectionReader:
+		position, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return r.Size() - position
+	}
+	return -1
+}
+
+// NewJobProgressFunc returns a ProgressFunc for the transfers of a job with
+// the number of files. It adds the progress of the job to the reports and
+// passes them to fn. The returned function may be called concurrently, fn is
+// called by one goroutine at a time.
+func NewJobProgressFunc(files int, fn ProgressFunc) ProgressFunc {
+	var lock sync.Mutex
+	job := JobProgress{Files: files}
+	transfers := make(map[string]Progress) // running transfers by path
+
+	return func(progress Progress) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		previous, running := transfers[progress.Path]
+		if !running {
+			previous.Total = -1
+		}
+		job.Done += progress.Done - previous.Done
+		if progress.Total >= 0 {
+			job.Total += progress.Total
+		}
+		if previous.Total >= 0 {
+			job.Total -= previous.Total
+		}
+		if progress.Finished {
+			job.Finished++
+			delete(transfers, progress.Path)
+		} else {
+			transfers[progress.Path] = progress
+		}
+
+		job.Rate = 0
+		known := true
+		for _, transfer := range transfers {
+			job.Rate += transfer.Rate
+			known = known && transfer.Total >= 0
+		}
+		job.ETA = estimate(job.Total-job.Done, job.Rate, known)
+		if job.Finished == job.Files {
+			job.ETA = 0
+		}
+
+		jobCopy := job
+		progress.Job = &jobCopy
+		fn(progress)
+	}
+}
@@ -0,0 +1,247 @@
+package ftps_qftp_client
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// DefaultReadAhead is the default size of the read-ahead window of a RemoteFile
+const DefaultReadAhead = 64 * 1024
+
+// RemoteFile provides random access to a file on the remote FTP server, it
+// implements io.ReadSeeker, io.ReaderAt and io.Closer. The data is retrieved
+// with RetrFrom in windows of the read-ahead size. A transfer is kept open for
+// sequential reads and aborted, when a read starts somewhere else.
+//
+// While a transfer is open, the connection can not be used for other
+// operations. The transfer is closed, when the end of the file is reached or
+// the RemoteFile is closed. The file must be read in binary mode, because the
+// offsets of ASCII mode count the bytes of the NVT-ASCII data.
+type RemoteFile struct {
+	conn      ConnectionI
+	path      string
+	size      int64
+	readAhead int
+
+	lock         sync.Mutex // ReadAt may be called concurrently
+	offset       int64      // offset of Read and Seek
+	reader       io.ReadCloser
+	readerOffset int64  // offset of the next byte of reader
+	window       []byte // data read ahead
+	windowOffset int64  // offset of window[0]
+	closed       bool
+}
+
+// OpenRemoteFile opens the file on the remote FTP server for random access.
+// The size of the file is determined with FileSize.
+func OpenRemoteFile(conn ConnectionI, path string) (*RemoteFile, error) {
+	size, err := conn.FileSize(path)
+	if err != nil {
+		return nil, err
+	}
+	return newRemoteFile(conn, path, int64(size)), nil
+}
+
+func newRemoteFile(conn ConnectionI, path string, size int64) *RemoteFile {
+	return &RemoteFile{conn: conn, path: path, size: size, readAhead: DefaultReadAhead}
+}
+
+// SetReadAhead sets the size of the read-ahead window. Each read from the
+// server retrieves at least this number of bytes, larger reads bypass the
+// window.
+func (f *RemoteFile) SetReadAhead(size int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if size < 1 {
+		size = 1
+	}
+	f.readAhead = size
+}
+
+// Size returns the size of the file.
+func (f *RemoteFile) Size() int64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.size
+}
+
+// Read implements the io.Reader interface.
+func (f *RemoteFile) Read(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt implements the io.ReaderAt interface.
+func (f *RemoteFile) ReadAt(p []byte, offset int64) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if offset < 0 {
+		return 0, errors.New("Negative offset.")
+	}
+	return f.readAt(p, offset)
+}
+
+// Seek implements the io.Seeker interface. The open transfer is aborted with
+// the next read, if it does not continue at the new offset.
+func (f *RemoteFile) Seek(offset int64, whence int) (int64, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return 0, errors.New("The remote file is closed.")
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("Invalid whence.")
+	}
+	if offset < 0 {
+		return 0, errors.New("Negative offset.")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close closes the open transfer.
+func (f *RemoteFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return errors.New("The remote file is already closed.")
+	}
+	f.closed = true
+	f.window = nil
+	return f.closeReader()
+}
+
+// readAt reads from the window and refills it until p is full. Reads of at
+// least the read-ahead size bypass the window.
+func (f *RemoteFile) readAt(p []byte, offset int64) (int, error) {
+	if f.closed {
+		return 0, errors.New("The remote file is closed.")
+	}
+	n := 0
+	for n < len(p) {
+		position := offset + int64(n)
+		if position >= f.size {
+			return n, io.EOF
+		}
+		if position >= f.windowOffset && position < f.windowOffset+int64(len(f.window)) {
+			n += copy(p[n:], f.window[position-f.windowOffset:])
+			continue
+		}
+		read, err := f.fill(position, p[n:])
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// fill reads the window at the position or, if p is at least as large as
+// the window, directly into p and returns the number of bytes read into p.
+// The open transfer is used, if the position is at most one window ahead,
+// otherwise it is aborted and a new transfer is started with RetrFrom.
+func (f *RemoteFile) fill(position int64, p []byte) (int, error) {
+	if f.reader != nil && (position < f.readerOffset || position-f.readerOffset > int64(f.readAhead)) {
+		// The caller seeked away
+		f.closeReader()
+	}
+	if f.reader == nil {
+		reader, err := f.conn.RetrFrom(f.path, uint64(position))
+		if err != nil {
+			return 0, err
+		}
+		f.reader = reader
+		f.readerOffset = position
+	}
+
+	if position > f.readerOffset {
+		skipped, err := io.CopyN(ioutil.Discard, f.reader, position-f.readerOffset)
+		f.readerOffset += skipped
+		if err != nil {
+			return 0, f.endOfStream(err)
+		}
+	}
+
+	remaining := f.size - position
+	if len(p) >= f.readAhead {
+		// The window would not be reused
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+		n, err := io.ReadFull(f.reader, p)
+		f.readerOffset += int64(n)
+		if err != nil {
+			return n, f.endOfStream(err)
+		}
+		return n, f.endOfData()
+	}
+
+	length := f.readAhead
+	if int64(length) > remaining {
+		length = int(remaining)
+	}
+	if cap(f.window) < length || cap(f.window) > f.readAhead {
+		f.window = make([]byte, f.readAhead)
+	}
+	n, err := io.ReadFull(f.reader, f.window[:length])
+	f.window = f.window[:n]
+	f.windowOffset = position
+	f.readerOffset += int64(n)
+	if err != nil {
+		return 0, f.endOfStream(err)
+	}
+	return 0, f.endOfData()
+}
+
+// endOfData completes the transfer, when the end of the data is read, so it
+// is closed without ABOR.
+func (f *RemoteFile) endOfData() error {
+	if f.readerOffset < f.size {
+		return nil
+	}
+	_, err := f.reader.Read(make([]byte, 1))
+	if err != nil && err != io.EOF {
+		f.closeReader()
+		return err
+	}
+	return f.closeReader()
+}
+
+// endOfStream closes the transfer after an error while reading. At the end of
+// the data the file ends at the current offset, if it is shorter than its
+// size.
+func (f *RemoteFile) endOfStream(err error) error {
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		f.closeReader()
+		return err
+	}
+	if f.readerOffset < f.size {
+		f.size = f.readerOffset
+	}
+	return f.closeReader()
+}
+
+// closeReader closes the open transfer, which is aborted if it is not
+// complete.
+func (f *RemoteFile) closeReader() error {
+	if f.reader == nil {
+		return nil
+	}
+	err := f.reader.Close()
+	f.reader = nil
+	return err
+}
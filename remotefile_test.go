@@ -0,0 +1,72 @@
+package ftps_qftp_client
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// fileConn is a connection with one file for RemoteFile, the other methods
+// of ConnectionI are not implemented
+type fileConn struct {
+	ConnectionI
+	data      []byte
+	transfers int
+}
+
+func (c *fileConn) RetrFrom(path string, offset uint64) (io.ReadCloser, error) {
+	c.transfers++
+	return ioutil.NopCloser(bytes.NewReader(c.data[offset:])), nil
+}
+
+func TestRemoteFileLargeReads(t *testing.T) {
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	conn := &fileConn{data: data}
+	f := newRemoteFile(conn, "large.bin", int64(len(data)))
+	f.SetReadAhead(1024)
+
+	buf := make([]byte, 50000)
+	_, err := io.ReadFull(f, buf[:100])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The rest of the window and then directly into buf
+	_, err = io.ReadFull(f, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data[100:50100]) {
+		t.Error("unexpected data")
+	}
+	if cap(f.window) > 1024 {
+		t.Errorf("window of %d bytes exceeds the read-ahead", cap(f.window))
+	}
+
+	rest, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, data[50100:]) {
+		t.Error("unexpected data at the end")
+	}
+	if cap(f.window) > 1024 {
+		t.Errorf("window of %d bytes exceeds the read-ahead", cap(f.window))
+	}
+
+	n, err := f.ReadAt(buf, int64(len(data)-10))
+	if err != io.EOF || n != 10 || !bytes.Equal(buf[:10], data[len(data)-10:]) {
+		t.Errorf("expected io.EOF after 10 bytes, got %d %v", n, err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.transfers != 2 {
+		t.Errorf("expected 2 transfers, got %d", conn.transfers)
+	}
+}
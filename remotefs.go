@@ -0,0 +1,260 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+)
+
+// RemoteFS provides the files of a remote FTP server as a file system, it
+// implements fs.FS, fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+//
+// The opened files retrieve the data with RetrFrom over the connection, so the
+// connection can not be used for other operations until the file is closed.
+// Like the connection a RemoteFS must not be used concurrently.
+type RemoteFS struct {
+	conn ConnectionI
+	root string
+}
+
+// NewRemoteFS returns a file system with the files below the directory root
+// on the server. An empty root is the current directory of the connection.
+func NewRemoteFS(conn ConnectionI, root string) *RemoteFS {
+	if root == "" {
+		root = "."
+	}
+	return &RemoteFS{conn: conn, root: root}
+}
+
+// Open opens the named file for reading. The data of a file is retrieved
+// with RetrFrom, see RemoteFile, a directory is listed when it is opened.
+func (fsys *RemoteFS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		entries, err := fsys.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &remoteDir{info: info, entries: entries}, nil
+	}
+
+	size := info.Size()
+	if info.entry.Type != EntryTypeFile {
+		// The size of a link in the listing is the length of its target
+		fileSize, err := fsys.conn.FileSize(fsys.remotePath(name))
+		if err != nil {
+			return nil, pathError("open", name, err)
+		}
+		size = int64(fileSize)
+	}
+	return &remoteFile{RemoteFile: newRemoteFile(fsys.conn, fsys.remotePath(name), size), info: info}, nil
+}
+
+// ReadDir lists the named directory with ListMachine. The entries are sorted
+// by their names.
+func (fsys *RemoteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !validPath(name) {
+		return nil, pathError("readdir", name, fs.ErrInvalid)
+	}
+	entries, err := listDir(context.Background(), fsys.conn, fsys.remotePath(name), ListMachine)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	dirEntries := make([]fs.DirEntry, len(entries))
+	for i, entry := range entries {
+		dirEntries[i] = entry.DirEntry()
+	}
+	return dirEntries, nil
+}
+
+// Stat returns the information about the named file.
+func (fsys *RemoteFS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.stat("stat", name)
+}
+
+// ReadFile retrieves the named file and returns its content.
+func (fsys *RemoteFS) ReadFile(name string) ([]byte, error) {
+	if !validPath(name) {
+		return nil, pathError("readfile", name, fs.ErrInvalid)
+	}
+	reader, err := fsys.conn.Retr(fsys.remotePath(name))
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	closeErr := reader.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// validPath reports whether the name is valid for fs.FS. Like the names of
+// the entries, see ValidEntryName, it must not contain a backslash, which is
+// a path separator for some servers.
+func validPath(name string) bool {
+	return fs.ValidPath(name) && !strings.Contains(name, "\\")
+}
+
+// remotePath returns the path of the named file on the server.
+func (fsys *RemoteFS) remotePath(name string) string {
+	return path.Join(fsys.root, name)
+}
+
+// stat determines the entry of the named file with Stat. Because not every
+// server can stat every file, the entry is searched in the listing of the
+// parent directory, if Stat fails.
+func (fsys *RemoteFS) stat(op string, name string) (*entryInfo, error) {
+	if !validPath(name) {
+		return nil, pathError(op, name, fs.ErrInvalid)
+	}
+	if name == "." {
+		return &entryInfo{name: ".", entry: &Entry{Name: fsys.root, Type: EntryTypeFolder}}, nil
+	}
+
+	entry, err := fsys.conn.Stat(fsys.remotePath(name))
+	if err == nil && entry != nil && entry.Type != EntryTypeLink {
+		return &entryInfo{name: path.Base(name), entry: entry}, nil
+	}
+
+	// The name of a link in the listing also contains the target
+	entries, err := listDir(context.Background(), fsys.conn, fsys.remotePath(path.Dir(name)), ListMachine)
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	for _, entry := range entries {
+		if entry.FileName() == path.Base(name) {
+			return &entryInfo{name: path.Base(name), entry: entry}, nil
+		}
+	}
+	return nil, pathError(op, name, fs.ErrNotExist)
+}
+
+// pathError returns a *fs.PathError. The reply "550 File unavailable" of the
+// server is reported as fs.ErrNotExist.
+func pathError(op string, name string, err error) error {
+	if protoErr, ok := err.(*textproto.Error); ok && protoErr.Code == 550 {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// FileInfo returns the entry as fs.FileInfo.
+func (e *Entry) FileInfo() fs.FileInfo {
+	return &entryInfo{name: e.FileName(), entry: e}
+}
+
+// DirEntry returns the entry as fs.DirEntry.
+func (e *Entry) DirEntry() fs.DirEntry {
+	return &entryInfo{name: e.FileName(), entry: e}
+}
+
+// entryInfo implements fs.FileInfo and fs.DirEntry for an Entry
+type entryInfo struct {
+	name  string
+	entry *Entry
+}
+
+func (info *entryInfo) Name() string {
+	return info.name
+}
+
+func (info *entryInfo) Size() int64 {
+	return int64(info.entry.Size)
+}
+
+// Mode returns the type of the entry and the permissions of the unix.mode
+// fact, which are only known from machine-readable listings.
+func (info *entryInfo) Mode() fs.FileMode {
+	mode := info.entry.Mode & fs.ModePerm
+	switch info.entry.Type {
+	case EntryTypeFolder:
+		mode |= fs.ModeDir
+	case EntryTypeLink:
+		mode |= fs.ModeSymlink
+	}
+	return mode
+}
+
+func (info *entryInfo) ModTime() time.Time {
+	return info.entry.Time
+}
+
+func (info *entryInfo) IsDir() bool {
+	return info.entry.Type == EntryTypeFolder
+}
+
+// Sys returns the *Entry.
+func (info *entryInfo) Sys() interface{} {
+	return info.entry
+}
+
+func (info *entryInfo) Type() fs.FileMode {
+	return info.Mode().Type()
+}
+
+func (info *entryInfo) Info() (fs.FileInfo, error) {
+	return info, nil
+}
+
+func (info *entryInfo) String() string {
+	return fs.FormatFileInfo(info)
+}
+
+// remoteFile is a file of a RemoteFS, it also implements io.Seeker and
+// io.ReaderAt with the RemoteFile
+type remoteFile struct {
+	*RemoteFile
+	info *entryInfo
+}
+
+func (f *remoteFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// remoteDir is a directory of a RemoteFS with the entries listed by Open
+type remoteDir struct {
+	info    *entryInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *remoteDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *remoteDir) Read(p []byte) (int, error) {
+	return 0, pathError("read", d.info.name, errors.New("is a directory"))
+}
+
+func (d *remoteDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries like fs.ReadDirFile.
+func (d *remoteDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(entries) {
+			entries = entries[:n]
+		}
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
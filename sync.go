@@ -0,0 +1,301 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SyncMode is the direction of a synchronization with Sync.
+type SyncMode int
+
+// The different directions of a synchronization
+const (
+	SyncMirrorUpload   SyncMode = iota // the tree on the server is made equal to the local tree
+	SyncMirrorDownload                 // the local tree is made equal to the tree on the server
+	SyncBidirectional                  // missing files are copied to the other side, changed files are replaced by the newer one
+)
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	Mode             SyncMode
+	DeleteExtraneous bool          // delete the files of the target, which are not in the source, ignored by SyncBidirectional
+	DryRun           bool          // only plan the actions
+	Hash             HashAlgorithm // compare files of equal size by the checksum of the server, empty compares the modification time
+	TimeWindow       time.Duration // modification times within the window are equal, LIST reports just minutes or days
+	Parallel         int           // number of parallel connections for the transfers, at least one is used
+}
+
+// SyncActionKind is the kind of a planned SyncAction.
+type SyncActionKind int
+
+// The different actions of a synchronization
+const (
+	SyncUpload       SyncActionKind = iota // store the file or create the directory on the server
+	SyncDownload                           // retrieve the file or create the local directory
+	SyncDeleteLocal                        // remove the local file or directory tree
+	SyncDeleteRemote                       // remove the file or directory tree on the server
+	SyncConflict                           // the file differs, but it can not be decided which one is newer
+)
+
+func (kind SyncActionKind) String() string {
+	switch kind {
+	case SyncUpload:
+		return "upload"
+	case SyncDownload:
+		return "download"
+	case SyncDeleteLocal:
+		return "delete local"
+	case SyncDeleteRemote:
+		return "delete remote"
+	case SyncConflict:
+		return "conflict"
+	}
+	return "unknown"
+}
+
+// SyncAction is an action planned by Sync.
+type SyncAction struct {
+	Kind    SyncActionKind
+	Path    string    // slash separated path relative to the local and the remote directory
+	Dir     bool      // the path is a directory
+	ModTime time.Time // modification time of the transferred file, set on the copy
+	Reason  string
+}
+
+// SyncReport is the result of Sync with the planned actions and the errors of
+// their execution.
+type SyncReport struct {
+	Actions []SyncAction
+	Errors  []error // empty for a dry run
+}
+
+// Count returns the number of actions of the kind.
+func (r *SyncReport) Count(kind SyncActionKind) int {
+	count := 0
+	for _, action := range r.Actions {
+		if action.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// syncFile is the state of a file or directory on one side of a synchronization
+type syncFile struct {
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+// PlanSync compares the local tree localDir with the tree remoteDir on the
+// remote FTP server and returns the actions to synchronize them according to
+// opts. Files are compared by their size and modification time or checksum.
+// A missing root directory is treated as an empty tree, symbolic links on
+// both sides are skipped.
+func PlanSync(conn ConnectionI, localDir string, remoteDir string, opts SyncOptions) ([]SyncAction, error) {
+	ctx := context.Background()
+	localFiles, err := scanLocal(localDir)
+	if err != nil {
+		return nil, err
+	}
+	remoteFiles, err := scanRemote(ctx, conn, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for name := range localFiles {
+		paths = append(paths, name)
+	}
+	for name := range remoteFiles {
+		if _, ok := localFiles[name]; !ok {
+			paths = append(paths, name)
+		}
+	}
+	// Parent directories are sorted before their content
+	sort.Strings(paths)
+
+	var actions []SyncAction
+	deleted := make(map[string]bool) // the content of a deleted directory is not planned
+	for _, name := range paths {
+		if insideDeleted(name, deleted) {
+			continue
+		}
+		local, localOK := localFiles[name]
+		remote, remoteOK := remoteFiles[name]
+
+		switch {
+		case !remoteOK:
+			if opts.Mode != SyncMirrorDownload {
+				actions = append(actions, SyncAction{Kind: SyncUpload, Path: name, Dir: local.dir, ModTime: local.modTime, Reason: "missing on the server"})
+			} else if opts.DeleteExtraneous {
+				actions = append(actions, SyncAction{Kind: SyncDeleteLocal, Path: name, Dir: local.dir, Reason: "missing on the server"})
+				deleted[name] = true
+			}
+		case !localOK:
+			if opts.Mode != SyncMirrorUpload {
+				actions = append(actions, SyncAction{Kind: SyncDownload, Path: name, Dir: remote.dir, ModTime: remote.modTime, Reason: "missing locally"})
+			} else if opts.DeleteExtraneous {
+				actions = append(actions, SyncAction{Kind: SyncDeleteRemote, Path: name, Dir: remote.dir, Reason: "missing locally"})
+				deleted[name] = true
+			}
+		case local.dir && remote.dir:
+			// nothing to compare
+		case local.dir != remote.dir:
+			actions = append(actions, SyncAction{Kind: SyncConflict, Path: name, Reason: "file and directory"})
+			deleted[name] = true
+		default:
+			action, err := compareFiles(ctx, conn, name, filepath.Join(localDir, filepath.FromSlash(name)), path.Join(remoteDir, name), local, remote, opts)
+			if err != nil {
+				return nil, err
+			}
+			if action != nil {
+				actions = append(actions, *action)
+			}
+		}
+	}
+	return actions, nil
+}
+
+// insideDeleted reports whether a parent directory of the path is deleted.
+// Sorting does not keep the content of a directory together, "a-b" is sorted
+// between "a" and "a/x".
+func insideDeleted(name string, deleted map[string]bool) bool {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if deleted[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// compareFiles compares a file on both sides and returns the action to
+// synchronize it or nil, if the files are equal.
+func compareFiles(ctx context.Context, conn ConnectionI, name string, localPath string, remotePath string, local syncFile, remote syncFile, opts SyncOptions) (*SyncAction, error) {
+	reason := "different size"
+	if local.size == remote.size {
+		if opts.Hash != "" {
+			equal, err := equalChecksums(ctx, conn, localPath, remotePath, opts.Hash)
+			if err != nil || equal {
+				return nil, err
+			}
+			reason = "different checksum"
+		} else {
+			if absDuration(local.modTime.Sub(remote.modTime)) <= opts.TimeWindow {
+				return nil, nil
+			}
+			reason = "different modification time"
+		}
+	}
+
+	switch opts.Mode {
+	case SyncMirrorUpload:
+		return &SyncAction{Kind: SyncUpload, Path: name, ModTime: local.modTime, Reason: reason}, nil
+	case SyncMirrorDownload:
+		return &SyncAction{Kind: SyncDownload, Path: name, ModTime: remote.modTime, Reason: reason}, nil
+	}
+	difference := local.modTime.Sub(remote.modTime)
+	if difference > opts.TimeWindow {
+		return &SyncAction{Kind: SyncUpload, Path: name, ModTime: local.modTime, Reason: reason + ", newer locally"}, nil
+	} else if -difference > opts.TimeWindow {
+		return &SyncAction{Kind: SyncDownload, Path: name, ModTime: remote.modTime, Reason: reason + ", newer on the server"}, nil
+	}
+	return &SyncAction{Kind: SyncConflict, Path: name, Reason: reason + ", same modification time"}, nil
+}
+
+// equalChecksums compares the checksum of the local file with the checksum
+// calculated by the server.
+func equalChecksums(ctx context.Context, conn ConnectionI, localPath string, remotePath string, algorithm HashAlgorithm) (bool, error) {
+	h, err := algorithm.New()
+	if err != nil {
+		return false, err
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return false, err
+	}
+	remote, err := conn.HashContext(ctx, remotePath, algorithm)
+	if err != nil {
+		return false, err
+	}
+	return NormalizeHash(algorithm, remote) == hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// scanLocal returns the files and directories below dir by their slash
+// separated relative paths.
+func scanLocal(dir string) (map[string]syncFile, error) {
+	files := make(map[string]syncFile)
+	err := filepath.Walk(dir, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if localPath == dir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if localPath == dir || !(info.IsDir() || info.Mode().IsRegular()) {
+			return nil
+		}
+		name, err := filepath.Rel(dir, localPath)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(name)] = syncFile{dir: info.IsDir(), size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("Error while reading the local directory. " + err.Error())
+	}
+	return files, nil
+}
+
+// scanRemote walks the tree dir on the server and returns the files and
+// directories by their paths relative to dir.
+func scanRemote(ctx context.Context, conn ConnectionI, dir string) (map[string]syncFile, error) {
+	files := make(map[string]syncFile)
+	root := path.Clean(dir)
+	err := WalkContext(ctx, conn, dir, WalkOptions{}, func(remotePath string, entry *Entry, err error) error {
+		if err != nil {
+			if protoErr, ok := err.(*textproto.Error); ok && protoErr.Code == 550 && remotePath == dir {
+				// the directory does not exist yet
+				return SkipDir
+			}
+			return err
+		}
+		if remotePath == dir || entry.Type == EntryTypeLink {
+			return nil
+		}
+		name := strings.TrimPrefix(remotePath, root+"/")
+		if root == "." {
+			name = remotePath
+		} else if root == "/" {
+			name = strings.TrimPrefix(remotePath, "/")
+		}
+		files[name] = syncFile{dir: entry.Type == EntryTypeFolder, size: int64(entry.Size), modTime: entry.Time}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
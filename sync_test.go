@@ -0,0 +1,119 @@
+package ftps_qftp_client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plansync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := time.Date(2015, time.August, 13, 0, 0, 0, 0, time.UTC)
+	recent := old.Add(time.Hour)
+	for name, modTime := range map[string]time.Time{"same.txt": old, "newer.txt": recent, "older.txt": old, "conflict.txt": old, "local/a.txt": old} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		err = ioutil.WriteFile(path, []byte("local"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	conn := &walkConn{listings: map[string][]*Entry{
+		"remote": {
+			{Name: "same.txt", Type: EntryTypeFile, Size: 5, Time: old.Add(30 * time.Second)},
+			{Name: "newer.txt", Type: EntryTypeFile, Size: 5, Time: old},
+			{Name: "older.txt", Type: EntryTypeFile, Size: 6, Time: recent},
+			{Name: "conflict.txt", Type: EntryTypeFile, Size: 6, Time: old},
+			{Name: "remote", Type: EntryTypeFolder},
+		},
+		"remote/remote": {
+			{Name: "b.txt", Type: EntryTypeFile, Size: 1, Time: old},
+		},
+	}}
+
+	opts := SyncOptions{Mode: SyncBidirectional, TimeWindow: time.Minute}
+	actions, err := PlanSync(conn, dir, "remote", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SyncAction{
+		{Kind: SyncConflict, Path: "conflict.txt", Reason: "different size, same modification time"},
+		{Kind: SyncUpload, Path: "local", Dir: true, Reason: "missing on the server"},
+		{Kind: SyncUpload, Path: "local/a.txt", ModTime: old, Reason: "missing on the server"},
+		{Kind: SyncUpload, Path: "newer.txt", ModTime: recent, Reason: "different modification time, newer locally"},
+		{Kind: SyncDownload, Path: "older.txt", ModTime: recent, Reason: "different size, newer on the server"},
+		{Kind: SyncDownload, Path: "remote", Dir: true, Reason: "missing locally"},
+		{Kind: SyncDownload, Path: "remote/b.txt", ModTime: old, Reason: "missing locally"},
+	}
+	// The modification time of a local directory is not compared
+	for i := range actions {
+		if actions[i].Dir {
+			actions[i].ModTime = time.Time{}
+		}
+		actions[i].ModTime = actions[i].ModTime.UTC()
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("got %v, expected %v", actions, expected)
+	}
+
+	// A mirror removes the content of an extraneous directory with the directory
+	opts = SyncOptions{Mode: SyncMirrorUpload, DeleteExtraneous: true, TimeWindow: time.Minute}
+	actions, err = PlanSync(conn, dir, "remote", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deletions []string
+	for _, action := range actions {
+		if action.Kind == SyncDeleteRemote {
+			deletions = append(deletions, action.Path)
+		}
+	}
+	if !reflect.DeepEqual(deletions, []string{"remote"}) {
+		t.Errorf("unexpected deletions %q", deletions)
+	}
+}
+
+func TestPlanSyncDeletedDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plansync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// "a-b" is sorted between "a" and its content "a/x"
+	conn := &walkConn{listings: map[string][]*Entry{
+		"remote": {
+			{Name: "a", Type: EntryTypeFolder},
+			{Name: "a-b", Type: EntryTypeFile, Size: 1},
+		},
+		"remote/a": {
+			{Name: "x", Type: EntryTypeFile, Size: 1},
+		},
+	}}
+
+	opts := SyncOptions{Mode: SyncMirrorUpload, DeleteExtraneous: true}
+	actions, err := PlanSync(conn, dir, "remote", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deletions []string
+	for _, action := range actions {
+		deletions = append(deletions, action.Path)
+		if action.Kind != SyncDeleteRemote {
+			t.Errorf("unexpected action %v", action)
+		}
+	}
+	if !reflect.DeepEqual(deletions, []string{"a", "a-b"}) {
+		t.Errorf("unexpected deletions %q", deletions)
+	}
+}
@@ -0,0 +1,267 @@
+package ftps_qftp_client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// TrustMode describes how the certificate of the server is verified.
+type TrustMode int
+
+// The different trust sources for the certificate of the server
+const (
+	TrustSystemRoots TrustMode = iota // verify the chain with the root CAs of the system
+	TrustCAFile                       // verify the chain with the CAs in TLSOptions.CAFile
+	TrustPinned                       // accept only certificates with a fingerprint in TLSOptions.Pins
+	TrustInsecure                     // accept every certificate, vulnerable to man-in-the-middle attacks
+)
+
+// TLSOptions configures the verification of the certificate of the server
+// and the certificate of the client for mutual TLS.
+type TLSOptions struct {
+	Trust  TrustMode
+	CAFile string   // PEM file with the trusted CAs or the self-signed certificate of the server
+	Pins   []string // hex encoded SHA-256 fingerprints of the accepted certificates, colons are ignored
+
+	CertFile string // PEM file with the certificate of the client, optional
+	KeyFile  string // PEM file with the private key of the client certificate
+	// KeyPassword is the password of an encrypted private key, it is ignored for
+	// an unencrypted key. Use PKCS #8 keys encrypted with PBES2, the legacy PEM
+	// encryption of RFC 1423 ("Proc-Type: 4,ENCRYPTED") is insecure by design and
+	// only supported to read old keys.
+	KeyPassword string
+}
+
+// CertificateErrorKind describes why the certificate of the server was rejected.
+type CertificateErrorKind int
+
+// The different reasons to reject a certificate
+const (
+	CertificateInvalid          CertificateErrorKind = iota // malformed or not usable for a server
+	CertificateUnknownAuthority                             // not signed by a trusted CA
+	CertificateHostnameMismatch                             // not valid for the name of the server
+	CertificateExpired                                      // expired or not yet valid
+	CertificatePinMismatch                                  // fingerprint is not pinned
+)
+
+// CertificateError is returned, when the certificate of the server is rejected.
+type CertificateError struct {
+	Kind        CertificateErrorKind
+	ServerName  string
+	Fingerprint string // hex encoded SHA-256 fingerprint of the certificate of the server
+	Err         error  // error of the chain verification, nil for CertificatePinMismatch
+}
+
+func (e *CertificateError) Error() string {
+	var reason string
+	switch e.Kind {
+	case CertificateUnknownAuthority:
+		reason = "is signed by an unknown authority"
+	case CertificateHostnameMismatch:
+		reason = "is not valid for " + e.ServerName
+	case CertificateExpired:
+		reason = "is expired or not yet valid"
+	case CertificatePinMismatch:
+		reason = "does not match a pinned fingerprint"
+	default:
+		reason = "is invalid"
+	}
+	message := "Certificate of server " + e.ServerName + " " + reason + " (SHA-256 " + e.Fingerprint + ")."
+	if e.Err != nil {
+		message = message + " " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *CertificateError) Unwrap() error {
+	return e.Err
+}
+
+// CertificateFingerprint returns the hex encoded SHA-256 fingerprint of a
+// DER encoded certificate, as used for pinning.
+func CertificateFingerprint(certificate []byte) string {
+	sum := sha256.Sum256(certificate)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTLSConfig creates a TLS configuration, which verifies the certificate of
+// the server with the given name according to the options.
+// The name is also sent with SNI, if it is not an IP address.
+func NewTLSConfig(serverName string, options TLSOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: serverName}
+
+	if options.CertFile != "" {
+		certificate, err := loadClientCertificate(options)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	switch options.Trust {
+	case TrustSystemRoots:
+		// verified with the system roots, if RootCAs is nil
+	case TrustCAFile:
+		certificates, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(certificates) {
+			return nil, errors.New("No certificates found in " + options.CAFile + ".")
+		}
+		tlsConfig.RootCAs = rootCAs
+	case TrustPinned:
+		if len(options.Pins) == 0 {
+			return nil, errors.New("No certificate fingerprints to pin.")
+		}
+	case TrustInsecure:
+		tlsConfig.InsecureSkipVerify = true
+		return tlsConfig, nil
+	default:
+		return nil, errors.New("Unknown trust mode.")
+	}
+
+	// The verification is done in VerifyPeerCertificate to return a
+	// CertificateError and to support pinning.
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		return verifyCertificate(serverName, options, tlsConfig.RootCAs, rawCerts)
+	}
+	return tlsConfig, nil
+}
+
+// loadClientCertificate loads the certificate and the private key of the
+// client and decrypts the key with the password.
+func loadClientCertificate(options TLSOptions) (tls.Certificate, error) {
+	certificatePEM, err := ioutil.ReadFile(options.CertFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyFile := options.KeyFile
+	if keyFile == "" {
+		// certificate and key in the same file
+		keyFile = options.CertFile
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if options.KeyPassword != "" {
+		keyPEM, err = decryptPEMKey(keyPEM, options.KeyPassword)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	certificate, err := tls.X509KeyPair(certificatePEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, errors.New("Error while loading the client certificate. " + err.Error())
+	}
+	return certificate, nil
+}
+
+// decryptPEMKey decrypts the encrypted private key in the PEM data. Supported
+// are PKCS #8 keys "ENCRYPTED PRIVATE KEY" encrypted with PBES2, see
+// decryptPKCS8, and the legacy PEM encryption of RFC 1423 with the deprecated
+// x509.DecryptPEMBlock. The legacy encryption is insecure by design and only
+// supported for old keys. The data of an unencrypted key is returned
+// unchanged, the password is not needed.
+func decryptPEMKey(data []byte, password string) ([]byte, error) {
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("No private key found.")
+		}
+
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			key, err := decryptPKCS8(block.Bytes, []byte(password))
+			if err != nil {
+				return nil, errors.New("Error while decrypting the private key. " + err.Error())
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), nil
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		if !x509.IsEncryptedPEMBlock(block) {
+			return data, nil
+		}
+
+		key, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, errors.New("Error while decrypting the private key. " + err.Error())
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: key}), nil
+	}
+}
+
+// verifyCertificate verifies the certificate chain sent by the server.
+func verifyCertificate(serverName string, options TLSOptions, rootCAs *x509.CertPool, rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return &CertificateError{Kind: CertificateInvalid, ServerName: serverName, Err: errors.New("no certificate sent by the server")}
+	}
+	certErr := &CertificateError{ServerName: serverName, Fingerprint: CertificateFingerprint(rawCerts[0])}
+
+	if options.Trust == TrustPinned {
+		for _, pin := range options.Pins {
+			if strings.ToLower(strings.Replace(pin, ":", "", -1)) == certErr.Fingerprint {
+				return nil
+			}
+		}
+		certErr.Kind = CertificatePinMismatch
+		return certErr
+	}
+
+	certificates := make([]*x509.Certificate, len(rawCerts))
+	for i, rawCert := range rawCerts {
+		certificate, err := x509.ParseCertificate(rawCert)
+		if err != nil {
+			certErr.Kind = CertificateInvalid
+			certErr.Err = err
+			return certErr
+		}
+		certificates[i] = certificate
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err := certificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         rootCAs,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+	})
+	if err == nil {
+		return nil
+	}
+
+	certErr.Err = err
+	switch err := err.(type) {
+	case x509.UnknownAuthorityError:
+		certErr.Kind = CertificateUnknownAuthority
+	case x509.HostnameError:
+		certErr.Kind = CertificateHostnameMismatch
+	case x509.CertificateInvalidError:
+		if err.Reason == x509.Expired {
+			certErr.Kind = CertificateExpired
+		} else {
+			certErr.Kind = CertificateInvalid
+		}
+	default:
+		certErr.Kind = CertificateInvalid
+	}
+	return certErr
+}
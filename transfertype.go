@@ -0,0 +1,125 @@
+package ftps_qftp_client
+
+import (
+	"io"
+	"io/ioutil"
+	"runtime"
+)
+
+// TransferType is the representation type of the transferred files, set with
+// TYPE (RFC 959).
+type TransferType byte
+
+// The supported transfer types
+const (
+	TransferTypeBinary TransferType = 'I' // image, the data is transferred unchanged
+	TransferTypeASCII  TransferType = 'A' // NVT-ASCII, lines end with CRLF during the transfer
+)
+
+// localNewline is the newline convention of the local system
+var localNewline = localNewlineFor(runtime.GOOS)
+
+func localNewlineFor(goos string) []byte {
+	if goos == "windows" {
+		return []byte("\r\n")
+	}
+	return []byte("\n")
+}
+
+// nvtBufferSize is the size of the chunks read by the converters
+const nvtBufferSize = 32 * 1024
+
+// nvtReader converts the data of a reader chunk by chunk. The state of
+// the conversion is kept between the chunks.
+type nvtReader struct {
+	r       io.Reader
+	in      []byte
+	out     []byte // converted data, which is not yet read
+	cr      bool   // the last byte of the previous chunk was a CR
+	err     error
+	convert func(*nvtReader, []byte)
+}
+
+// NewNVTDecoder returns a reader, which converts the NVT-ASCII data of r to the
+// local newline convention. CRLF is converted to the local newline and CR NUL
+// to CR, as described in RFC 959 for ASCII transfers.
+func NewNVTDecoder(r io.Reader) io.Reader {
+	return &nvtReader{r: r, convert: (*nvtReader).decode}
+}
+
+// NewNVTEncoder returns a reader, which converts the data of r with the local
+// newline convention to NVT-ASCII. Every LF, which does not follow a CR, is
+// converted to CRLF.
+func NewNVTEncoder(r io.Reader) io.Reader {
+	return &nvtReader{r: r, convert: (*nvtReader).encode}
+}
+
+// NVTLength returns the length of the data of r converted to NVT-ASCII.
+// In ASCII mode the offsets of RetrFrom and StorFrom count the bytes of the
+// NVT-ASCII data like the server, not the bytes of the local file.
+func NVTLength(r io.Reader) (uint64, error) {
+	n, err := io.Copy(ioutil.Discard, NewNVTEncoder(r))
+	return uint64(n), err
+}
+
+// Read implements the io.Reader interface.
+func (c *nvtReader) Read(p []byte) (int, error) {
+	for len(c.out) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		if c.in == nil {
+			c.in = make([]byte, nvtBufferSize)
+		}
+		n, err := c.r.Read(c.in)
+		c.out = c.out[:0]
+		c.convert(c, c.in[:n])
+		if err != nil {
+			if err == io.EOF && c.cr {
+				// a CR at the end of the data stays unchanged
+				c.out = append(c.out, '\r')
+				c.cr = false
+			}
+			c.err = err
+		}
+	}
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// decode converts CRLF to the local newline and CR NUL to CR
+func (c *nvtReader) decode(data []byte) {
+	for _, b := range data {
+		if c.cr {
+			c.cr = false
+			switch b {
+			case '\n':
+				c.out = append(c.out, localNewline...)
+				continue
+			case 0:
+				c.out = append(c.out, '\r')
+				continue
+			default:
+				c.out = append(c.out, '\r')
+			}
+		}
+		if b == '\r' {
+			// decided with the next byte, which may be in the next chunk
+			c.cr = true
+			continue
+		}
+		c.out = append(c.out, b)
+	}
+}
+
+// encode converts a LF, which does not follow a CR, to CRLF
+func (c *nvtReader) encode(data []byte) {
+	for _, b := range data {
+		if b == '\n' && !c.cr {
+			c.out = append(c.out, '\r')
+		}
+		c.out = append(c.out, b)
+		c.cr = b == '\r'
+	}
+}
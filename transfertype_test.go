@@ -0,0 +1,75 @@
+package ftps_qftp_client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNVTDecoder(t *testing.T) {
+	defer func(newline []byte) { localNewline = newline }(localNewline)
+	localNewline = localNewlineFor("linux")
+
+	data := "line1\r\nline2\r\x00bare\rcr\r\n\r\nend\r"
+	expected := "line1\nline2\rbare\rcr\n\nend\r"
+
+	// Byte by byte to test CRLF over the boundaries of the chunks
+	result, err := ioutil.ReadAll(NewNVTDecoder(iotest.OneByteReader(strings.NewReader(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != expected {
+		t.Errorf("got %q, expected %q", result, expected)
+	}
+
+	// Decoding from an offset between CR and LF
+	result, err = ioutil.ReadAll(NewNVTDecoder(strings.NewReader(data[6:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != expected[5:] {
+		t.Errorf("got %q, expected %q", result, expected[5:])
+	}
+
+	localNewline = localNewlineFor("windows")
+	result, err = ioutil.ReadAll(NewNVTDecoder(iotest.HalfReader(strings.NewReader("a\r\nb\r\n"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != "a\r\nb\r\n" {
+		t.Errorf("got %q on windows", result)
+	}
+}
+
+func TestNVTEncoder(t *testing.T) {
+	data := "line1\nline2\r\nline3\rline4\n\n"
+	expected := "line1\r\nline2\r\nline3\rline4\r\n\r\n"
+
+	result, err := ioutil.ReadAll(NewNVTEncoder(iotest.OneByteReader(strings.NewReader(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != expected {
+		t.Errorf("got %q, expected %q", result, expected)
+	}
+
+	// Larger than the buffer of the encoder
+	large := bytes.Repeat([]byte("text\n"), nvtBufferSize)
+	result, err = ioutil.ReadAll(NewNVTEncoder(bytes.NewReader(large)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, bytes.Repeat([]byte("text\r\n"), nvtBufferSize)) {
+		t.Error("wrong result for large data")
+	}
+
+	length, err := NVTLength(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != uint64(len(expected)) {
+		t.Errorf("NVTLength is %d, expected %d", length, len(expected))
+	}
+}
@@ -0,0 +1,183 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SkipDir is returned by a WalkFunc to skip the directory of the call. For a
+// file the remaining entries of its directory are skipped.
+var SkipDir = errors.New("Skip this directory.")
+
+// SkipAll is returned by a WalkFunc to skip all remaining entries.
+var SkipAll = errors.New("Skip all remaining entries.")
+
+// ListStrategy selects the commands used by Walk to list a directory.
+type ListStrategy int
+
+// The different strategies to list a directory
+const (
+	ListMachine ListStrategy = iota // MLSD, LIST if the server does not support MLST, see ConnectionI.ListMachine
+	ListLIST                        // LIST, the format of the lines depends on the server
+	ListNLST                        // NLST for the names and SIZE for every name, entries without a size are directories
+)
+
+// WalkOptions configures Walk.
+type WalkOptions struct {
+	MaxDepth int          // entries deeper below the root are not visited, 0 means unlimited
+	List     ListStrategy // commands to list the directories
+}
+
+// WalkFunc is called by Walk for every visited file or directory, like
+// fs.WalkDirFunc. path is the root joined with the names of the entries.
+//
+// If the listing of a directory fails, the function is called a second
+// time for the directory with the error. If the function returns an error,
+// Walk stops with the error, except for SkipDir and SkipAll.
+type WalkFunc func(path string, entry *Entry, err error) error
+
+// Walk walks the directory tree root on the remote FTP server and calls fn
+// for every file and directory including root, like filepath.WalkDir. The
+// entries of a directory are visited in lexical order and links are not
+// followed.
+func Walk(conn ConnectionI, root string, fn WalkFunc) error {
+	return WalkContext(context.Background(), conn, root, WalkOptions{}, fn)
+}
+
+// WalkWithOptions is like Walk but with the depth limit and the listing
+// strategy of the options.
+func WalkWithOptions(conn ConnectionI, root string, opts WalkOptions, fn WalkFunc) error {
+	return WalkContext(context.Background(), conn, root, opts, fn)
+}
+
+// WalkContext is like WalkWithOptions but with a context.
+//
+// root is determined with Stat. Because not every server can stat a
+// directory, root is walked as a directory if Stat fails.
+func WalkContext(ctx context.Context, conn ConnectionI, root string, opts WalkOptions, fn WalkFunc) error {
+	entry, err := conn.StatContext(ctx, root)
+	if err != nil || entry == nil {
+		entry = &Entry{Name: path.Base(root), Type: EntryTypeFolder}
+	}
+	err = walk(ctx, conn, root, entry, 0, opts, fn)
+	if err == SkipDir || err == SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walk calls fn for the entry and walks its content, if it is a directory.
+func walk(ctx context.Context, conn ConnectionI, dir string, entry *Entry, depth int, opts WalkOptions, fn WalkFunc) error {
+	err := fn(dir, entry, nil)
+	if err != nil || entry.Type != EntryTypeFolder {
+		if err == SkipDir && entry.Type == EntryTypeFolder {
+			// the directory is skipped, not its parent
+			err = nil
+		}
+		return err
+	}
+	if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+		return nil
+	}
+
+	entries, err := listDir(ctx, conn, dir, opts.List)
+	if err != nil {
+		err = fn(dir, entry, err)
+		if err == SkipDir {
+			err = nil
+		}
+		return err
+	}
+
+	for _, child := range entries {
+		err = walk(ctx, conn, path.Join(dir, child.FileName()), child, depth+1, opts, fn)
+		if err == SkipDir {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listDir lists the directory with the strategy. The entries of the current
+// and parent directory are removed, the names of the other entries are
+// reduced to their last element and sorted.
+func listDir(ctx context.Context, conn ConnectionI, dir string, strategy ListStrategy) ([]*Entry, error) {
+	var entries []*Entry
+	var err error
+	switch strategy {
+	case ListMachine:
+		entries, err = conn.ListMachineContext(ctx, dir)
+	case ListLIST:
+		entries, err = conn.ListContext(ctx, dir)
+	case ListNLST:
+		entries, err = listWithSize(ctx, conn, dir)
+	default:
+		err = errors.New("Unknown list strategy.")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var valid []*Entry
+	for _, entry := range entries {
+		if entryType := strings.ToLower(entry.Facts["type"]); entryType == "cdir" || entryType == "pdir" {
+			// named by some servers with the path of the directory
+			continue
+		}
+		if entry.Type != EntryTypeLink {
+			entry.Name = baseName(entry.Name)
+		}
+		if !ValidEntryName(entry.FileName()) {
+			continue
+		}
+		valid = append(valid, entry)
+	}
+	sort.Slice(valid, func(i, j int) bool {
+		return valid[i].FileName() < valid[j].FileName()
+	})
+	return valid, nil
+}
+
+// listWithSize lists the names of the directory with NLST and determines the
+// type and size of the entries with SIZE.
+func listWithSize(ctx context.Context, conn ConnectionI, dir string) ([]*Entry, error) {
+	names, err := conn.NameListContext(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for _, name := range names {
+		name = baseName(name)
+		if !ValidEntryName(name) {
+			continue
+		}
+		size, err := conn.FileSizeContext(ctx, path.Join(dir, name))
+		if err != nil {
+			if _, ok := err.(*textproto.Error); !ok {
+				return nil, err
+			}
+			// SIZE is rejected for directories
+			entries = append(entries, &Entry{Name: name, Type: EntryTypeFolder})
+			continue
+		}
+		entries = append(entries, &Entry{Name: name, Type: EntryTypeFile, Size: size})
+	}
+	return entries, nil
+}
+
+// baseName returns the last element of a name, which some servers send
+// relative to the listed directory or with its path.
+func baseName(name string) string {
+	name = strings.TrimRight(name, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
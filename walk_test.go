@@ -0,0 +1,161 @@
+package ftps_qftp_client
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"reflect"
+	"testing"
+)
+
+// walkConn is a connection with a fixed tree for Walk, the other methods
+// of ConnectionI are not implemented
+type walkConn struct {
+	ConnectionI
+	listings map[string][]*Entry
+	names    map[string][]string
+	sizes    map[string]uint64
+}
+
+func (c *walkConn) StatContext(ctx context.Context, path string) (*Entry, error) {
+	return nil, &textproto.Error{Code: 500, Msg: "Unknown command."}
+}
+
+func (c *walkConn) ListMachineContext(ctx context.Context, path string) ([]*Entry, error) {
+	return c.ListContext(ctx, path)
+}
+
+func (c *walkConn) ListContext(ctx context.Context, path string) ([]*Entry, error) {
+	listing, ok := c.listings[path]
+	if !ok {
+		return nil, &textproto.Error{Code: 550, Msg: "Failed to open directory."}
+	}
+	// Walk may change the entries
+	var entries []*Entry
+	for _, entry := range listing {
+		copied := *entry
+		entries = append(entries, &copied)
+	}
+	return entries, nil
+}
+
+func (c *walkConn) NameListContext(ctx context.Context, path string) ([]string, error) {
+	return c.names[path], nil
+}
+
+func (c *walkConn) FileSizeContext(ctx context.Context, path string) (uint64, error) {
+	size, ok := c.sizes[path]
+	if !ok {
+		return 0, &textproto.Error{Code: 550, Msg: "Could not get file size."}
+	}
+	return size, nil
+}
+
+func newWalkConn() *walkConn {
+	return &walkConn{
+		listings: map[string][]*Entry{
+			"tree": {
+				{Name: ".", Type: EntryTypeFolder},
+				{Name: "..", Type: EntryTypeFolder},
+				{Name: "tree", Type: EntryTypeFolder, Facts: map[string]string{"type": "cdir"}},
+				{Name: "sub", Type: EntryTypeFolder},
+				{Name: "tree/b.txt", Type: EntryTypeFile},
+				{Name: "a.txt", Type: EntryTypeFile},
+				{Name: "link -> a.txt", Type: EntryTypeLink},
+				{Name: "broken", Type: EntryTypeFolder},
+			},
+			"tree/sub": {
+				{Name: "c.txt", Type: EntryTypeFile},
+			},
+		},
+		names: map[string][]string{
+			"tree":     {"tree/sub", "tree/a.txt", ".", ".."},
+			"tree/sub": {"c.txt"},
+		},
+		sizes: map[string]uint64{"tree/a.txt": 1, "tree/sub/c.txt": 3},
+	}
+}
+
+// walkPaths walks the tree and returns the visited paths, failed listings
+// are marked with !
+func walkPaths(t *testing.T, conn ConnectionI, opts WalkOptions, skip string) []string {
+	var paths []string
+	err := WalkWithOptions(conn, "tree", opts, func(path string, entry *Entry, err error) error {
+		if err != nil {
+			paths = append(paths, "!"+path)
+			return nil
+		}
+		paths = append(paths, path)
+		if path == skip {
+			return SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestWalk(t *testing.T) {
+	conn := newWalkConn()
+
+	paths := walkPaths(t, conn, WalkOptions{}, "")
+	expected := []string{"tree", "tree/a.txt", "tree/b.txt", "tree/broken", "!tree/broken", "tree/link", "tree/sub", "tree/sub/c.txt"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("got %q, expected %q", paths, expected)
+	}
+
+	paths = walkPaths(t, conn, WalkOptions{}, "tree/sub")
+	expected = []string{"tree", "tree/a.txt", "tree/b.txt", "tree/broken", "!tree/broken", "tree/link", "tree/sub"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("SkipDir: got %q, expected %q", paths, expected)
+	}
+
+	// SkipDir for a file skips the rest of the directory
+	paths = walkPaths(t, conn, WalkOptions{}, "tree/b.txt")
+	expected = []string{"tree", "tree/a.txt", "tree/b.txt"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("SkipDir for a file: got %q, expected %q", paths, expected)
+	}
+
+	paths = walkPaths(t, conn, WalkOptions{MaxDepth: 1}, "")
+	expected = []string{"tree", "tree/a.txt", "tree/b.txt", "tree/broken", "tree/link", "tree/sub"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("MaxDepth: got %q, expected %q", paths, expected)
+	}
+
+	paths = walkPaths(t, conn, WalkOptions{List: ListNLST}, "")
+	expected = []string{"tree", "tree/a.txt", "tree/sub", "tree/sub/c.txt"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("NLST: got %q, expected %q", paths, expected)
+	}
+}
+
+func TestWalkStop(t *testing.T) {
+	conn := newWalkConn()
+
+	var paths []string
+	err := Walk(conn, "tree", func(path string, entry *Entry, err error) error {
+		paths = append(paths, path)
+		if path == "tree/a.txt" {
+			return SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paths, []string{"tree", "tree/a.txt"}) {
+		t.Errorf("SkipAll: got %q", paths)
+	}
+
+	// The error of a failed listing is returned
+	err = Walk(conn, "tree", func(path string, entry *Entry, err error) error {
+		return err
+	})
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) || protoErr.Code != 550 {
+		t.Errorf("expected the error of the listing, got %v", err)
+	}
+}